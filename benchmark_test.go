@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// BenchmarkGol runs 100 turns of the 16x16, 64x64 and 512x512 images using 1-16 worker threads.
+// Run with go test -run ^$ -bench BenchmarkGol -benchmem to see the time and allocations per run.
+func BenchmarkGol(b *testing.B) {
+	os.Stdout = nil // Disable the io goroutine's output so it does not clutter the results.
+	for _, size := range []int{16, 64, 512} {
+		for threads := 1; threads <= 16; threads++ {
+			p := gol.Params{ImageWidth: size, ImageHeight: size, Turns: 100, Threads: threads}
+			b.Run(fmt.Sprintf("%dx%dx%d-%d", p.ImageWidth, p.ImageHeight, p.Turns, p.Threads), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					events := make(chan gol.Event)
+					go gol.Run(p, events, nil)
+					for range events {
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkPartition compares splitting the world into strips of rows, one per worker thread, with square tiles
+// of 4, 16 and 64 cells taken from the work queue, and with 4 cell tiles dealt out to workers that steal from
+// each other, running 100 turns of the 64x64 and 512x512 images.
+// Run with go test -run ^$ -bench BenchmarkPartition -benchmem.
+func BenchmarkPartition(b *testing.B) {
+	os.Stdout = nil // Disable the io goroutine's output so it does not clutter the results.
+	for _, size := range []int{64, 512} {
+		for _, threads := range []int{1, 2, 4, 8, 16} {
+			partitions := []struct {
+				name          string
+				strategy      string
+				width, height int
+			}{
+				{"strips", "shared", size, (size + threads - 1) / threads},
+				{"tiles4", "shared", 4, 4},
+				{"tiles16", "shared", 16, 16},
+				{"tiles64", "shared", 64, 64},
+				{"stealing4", "stealing", 4, 4},
+			}
+			for _, partition := range partitions {
+				p := gol.Params{ImageWidth: size, ImageHeight: size, Turns: 100, Threads: threads, Strategy: partition.strategy, TileWidth: partition.width, TileHeight: partition.height}
+				b.Run(fmt.Sprintf("%v-%dx%dx%d-%d", partition.name, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads), func(b *testing.B) {
+					b.ReportAllocs()
+					for i := 0; i < b.N; i++ {
+						events := make(chan gol.Event)
+						go gol.Run(p, events, nil)
+						for range events {
+						}
+					}
+				})
+			}
+		}
+	}
+}
+
+// BenchmarkLookup compares counting the neighbours of each cell with looking its next state up in a table,
+// running 100 turns of the 64x64 and 512x512 images using 1 and 4 worker threads.
+// Run with go test -run ^$ -bench BenchmarkLookup -benchmem.
+func BenchmarkLookup(b *testing.B) {
+	os.Stdout = nil // Disable the io goroutine's output so it does not clutter the results.
+	for _, size := range []int{64, 512} {
+		for _, threads := range []int{1, 4} {
+			for _, lookup := range []bool{false, true} {
+				p := gol.Params{ImageWidth: size, ImageHeight: size, Turns: 100, Threads: threads, Lookup: lookup}
+				name := "counting"
+				if lookup {
+					name = "lookup"
+				}
+				b.Run(fmt.Sprintf("%v-%dx%dx%d-%d", name, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads), func(b *testing.B) {
+					b.ReportAllocs()
+					for i := 0; i < b.N; i++ {
+						events := make(chan gol.Event)
+						go gol.Run(p, events, nil)
+						for range events {
+						}
+					}
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// TestEngine tests the dense, bit-packed and HashLife engines through the Engine interface on the 64x64 image,
+// stepping them to turn 100. The cells they report as flipped must turn the image into their snapshot, and
+// their alive cells must match the check image.
+func TestEngine(t *testing.T) {
+	for _, engine := range []string{"dense", "bitpacked", "hashlife"} {
+		p := gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 100, Threads: 4, Engine: engine}
+		t.Run(fmt.Sprintf("%v-%dx%dx%d-%d", p.Engine, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads), func(t *testing.T) {
+			e, err := gol.NewEngine(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer e.Stop()
+
+			world := make([][]byte, p.ImageHeight)
+			for y := range world {
+				world[y] = make([]byte, p.ImageWidth)
+			}
+			for _, cell := range readAliveCells("images/64x64.pgm", p.ImageWidth, p.ImageHeight) {
+				world[cell.Y][cell.X] = 1
+			}
+			e.Load(world, 0)
+
+			for turn := 0; turn < p.Turns; {
+				turns := e.Step(p.Turns - turn)
+				if turns < 1 || turns > p.Turns-turn {
+					t.Fatalf("ERROR: Asked for at most %v turns after turn %v, stepped %v", p.Turns-turn, turn, turns)
+				}
+				cells, states := e.Flipped()
+				for i, cell := range cells {
+					world[cell.Y][cell.X] = states[i]
+				}
+				turn += turns
+			}
+
+			snapshot := e.Snapshot()
+			for y := range world {
+				if string(world[y]) != string(snapshot[y]) {
+					t.Fatalf("ERROR: Applying the flipped cells gave a different row %v to the snapshot", y)
+				}
+			}
+			assertEqualBoard(t, e.Alive(), readAliveCells("check/images/64x64x100.pgm", p.ImageWidth, p.ImageHeight), p)
+		})
+	}
+}
+
+// TestGolVerify tests that engines, strategies and the lookup table verified against the dense and HashLife engines
+// run the 64x64 image for 100 turns in lockstep with them without diverging, and that the sparse engine is rejected.
+func TestGolVerify(t *testing.T) {
+	tests := []struct {
+		name string
+		p    gol.Params
+	}{
+		{"bitpacked-dense", gol.Params{Engine: "bitpacked", VerifyAgainst: "dense"}},
+		{"hashlife-dense", gol.Params{Engine: "hashlife", VerifyAgainst: "dense"}},
+		{"dense-hashlife", gol.Params{Engine: "dense", VerifyAgainst: "hashlife"}},
+		{"halo-dense", gol.Params{Strategy: "halo", VerifyAgainst: "dense"}},
+		{"lookup-dense", gol.Params{Lookup: true, VerifyAgainst: "dense"}},
+	}
+	expectedAlive := readAliveCells("check/images/64x64x100.pgm", 64, 64)
+	for _, test := range tests {
+		p := test.p
+		p.ImageWidth, p.ImageHeight, p.Turns, p.Threads = 64, 64, 100, 4
+		testName := fmt.Sprintf("%v-%dx%dx%d-%d", test.name, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+		t.Run(testName, func(t *testing.T) {
+			events := make(chan gol.Event)
+			go gol.Run(p, events, nil)
+			for event := range events {
+				switch e := event.(type) {
+				case gol.Divergence:
+					t.Fatalf("ERROR: %v after turn %v", e, e.CompletedTurns)
+				case gol.FinalTurnComplete:
+					if e.CompletedTurns != p.Turns {
+						t.Fatalf("ERROR: Expected %v completed turns, got %v", p.Turns, e.CompletedTurns)
+					}
+					assertEqualBoard(t, e.Alive, expectedAlive, p)
+				}
+			}
+		})
+	}
+
+	for _, p := range []gol.Params{{Engine: "sparse", VerifyAgainst: "dense"}, {VerifyAgainst: "sparse"}, {VerifyAgainst: "quadtree"}} {
+		p.ImageWidth, p.ImageHeight = 64, 64
+		if _, err := gol.NewRule(p); err == nil {
+			t.Errorf("ERROR: Expected an error verifying engine %q against %q", p.Engine, p.VerifyAgainst)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package gol
+
+import "uk.ac.bris.cs/gameoflife/util"
+
+// defaultTileSize is the width and height of the tiles the shared-memory workers take from their work queue
+// and track changes in, unless Params say otherwise, for each cell of the rule's reach. Small tiles keep an
+// oscillator from making much more than its own cells active, and let the workers share out even a few active
+// cells. Larger than Life rules count the neighbours of a tile over the tile padded by their range on every
+// side, so their tiles grow with the range to keep the padding a fixed share of the work.
+const defaultTileSize = 4
+
+// activeTiles tracks which tiles of the world can change on the next turn. Under a rule that is deterministic
+// and the same every turn, a cell can only change if a cell within its reach changed on the last turn, so only
+// the tiles within reach of a changed cell need to be worked out again. The rest of the board is left as it was.
+type activeTiles struct {
+	p             Params
+	topology      Topology
+	reach         int
+	width, height int // Of each tile, except the last in a row or column, which may be cut short
+	columns, rows int
+	isActive      []bool
+	all           bool // Whether every tile has to be worked out, as on the first turn
+	switches      map[int]bool
+}
+
+// newActiveTiles splits the world into tiles of p.TileWidth by p.TileHeight cells, with every tile active on
+// the first turn. Cells are reached as far away as by any rule in the schedule.
+func newActiveTiles(p Params, schedule []scheduledRule) *activeTiles {
+	reach := 1
+	switches := make(map[int]bool)
+	for _, scheduled := range schedule {
+		if r := ruleReach(scheduled.rule); r > reach {
+			reach = r
+		}
+		switches[scheduled.fromTurn] = true
+	}
+
+	width, height := workTileSize(p, reach)
+	a := &activeTiles{
+		p:        p,
+		topology: schedule[0].rule.topology,
+		reach:    reach,
+		width:    width,
+		height:   height,
+		columns:  (p.ImageWidth + width - 1) / width,
+		rows:     (p.ImageHeight + height - 1) / height,
+		all:      true,
+		switches: switches,
+	}
+	a.isActive = make([]bool, a.columns*a.rows)
+	return a
+}
+
+// workTileSize returns the width and height of the tiles p asks for, or of the default tiles for rules reaching
+// reach cells away, neither of which is more than the image.
+func workTileSize(p Params, reach int) (width, height int) {
+	width, height = p.TileWidth, p.TileHeight
+	if width <= 0 {
+		width = defaultTileSize * reach
+	}
+	if height <= 0 {
+		height = defaultTileSize * reach
+	}
+	if width > p.ImageWidth {
+		width = p.ImageWidth
+	}
+	if height > p.ImageHeight {
+		height = p.ImageHeight
+	}
+	return width, height
+}
+
+// bounds returns the columns startX up to endX and rows startY up to endY of a tile.
+func (a *activeTiles) bounds(p Params, tile int) (startX, endX, startY, endY int) {
+	startX, startY = (tile%a.columns)*a.width, (tile/a.columns)*a.height
+	endX, endY = startX+a.width, startY+a.height
+	if endX > p.ImageWidth {
+		endX = p.ImageWidth
+	}
+	if endY > p.ImageHeight {
+		endY = p.ImageHeight
+	}
+	return startX, endX, startY, endY
+}
+
+// active returns the tiles to work out on the turn in row-major order, and forgets which tiles changed.
+// Every tile is active on the first turn, when the rule switches, and under rules that depend on the turn.
+func (a *activeTiles) active(rule Rule, turn int) []int {
+	all := a.all || a.switches[turn] || dependsOnTurn(rule)
+	a.all = false
+
+	var tiles []int
+	for tile, active := range a.isActive {
+		if active || all {
+			tiles = append(tiles, tile)
+		}
+		a.isActive[tile] = false
+	}
+	return tiles
+}
+
+// change records the cells that changed on the last turn, making active every tile with a cell within their reach.
+// The cells around a changed cell are found through the topology, as crossing an edge can lead far away.
+func (a *activeTiles) change(cells []util.Cell) {
+	for _, cell := range cells {
+		for dy := -a.reach; dy <= a.reach; dy++ {
+			for dx := -a.reach; dx <= a.reach; dx++ {
+				x, y, ok := a.topology.wrap(a.p, cell.X+dx, cell.Y+dy)
+				if ok {
+					a.isActive[(y/a.height)*a.columns+x/a.width] = true
+				}
+			}
+		}
+	}
+}
+
+// dependsOnTurn reports whether a cell can change on a turn when nothing it reaches changed on the last,
+// because the rule, or the rule of any of its regions, is probabilistic or alternates its Margolus blocks.
+func dependsOnTurn(rule Rule) bool {
+	rules := []Rule{rule}
+	if rule.regions != nil {
+		rules = rule.regions.rules
+	}
+	for _, r := range rules {
+		if r.probabilistic() || r.margolus != nil {
+			return true
+		}
+	}
+	return false
+}
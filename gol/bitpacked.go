@@ -0,0 +1,246 @@
+package gol
+
+import (
+	"fmt"
+	"math/bits"
+	"strings"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// The bit-packed engine stores 64 cells in each uint64, with bit b of word i of a row holding the cell in
+// column 64*i+b. It counts the neighbours of 64 cells at once (SIMD within a register, or SWAR) by adding
+// the eight neighbouring bit planes of a row with bitwise full adders, so each cell's count ends up spread
+// over the same bit of four count words.
+
+// packedWorld is a world of two-state cells packed into rows of words.
+// Bits past ImageWidth in the last word of a row are always 0.
+type packedWorld struct {
+	width int
+	rows  [][]uint64
+}
+
+// isBitPacked reports whether p selects the bit-packed engine.
+func isBitPacked(p Params) bool {
+	return strings.EqualFold(strings.TrimSpace(p.Engine), "bitpacked")
+}
+
+// checkBitPacked returns an error if the rule cannot be run by the bit-packed engine.
+func checkBitPacked(p Params, rule Rule) error {
+	switch {
+	case rule.States != 2 || rule.table != nil || rule.margolus != nil || rule.transitions != nil:
+		return fmt.Errorf("the bit-packed engine can only run two state outer-totalistic rules, not %v", rule)
+	case rule.Range != 1 || rule.Neighbourhood != Moore || rule.Middle:
+		return fmt.Errorf("the bit-packed engine can only count the Moore neighbourhood, not the neighbourhood of %v", rule)
+	case rule.regions != nil || rule.probabilistic():
+		return fmt.Errorf("the bit-packed engine cannot run masks or probabilistic rules")
+	case !rule.topology.isTorus():
+		return fmt.Errorf("the bit-packed engine wraps its rows around a torus, so it cannot use topology %v", rule.topology)
+	}
+	return nil
+}
+
+// packWorld packs the alive cells of a world.
+func packWorld(world [][]byte) *packedWorld {
+	packed := &packedWorld{rows: make([][]uint64, len(world))}
+	if len(world) > 0 {
+		packed.width = len(world[0])
+	}
+	for y, row := range world {
+		packed.rows[y] = make([]uint64, (packed.width+63)/64)
+		for x, state := range row {
+			if state == alive {
+				packed.rows[y][x/64] |= 1 << (x % 64)
+			}
+		}
+	}
+	return packed
+}
+
+// shiftWest returns the row moved one cell east, so each cell holds its west neighbour, wrapping around the torus.
+func (packed *packedWorld) shiftWest(row, out []uint64) {
+	last := len(row) - 1
+	for i := last; i > 0; i-- {
+		out[i] = row[i]<<1 | row[i-1]>>63
+	}
+	out[0] = row[0]<<1 | row[last]>>((packed.width-1)%64)&1 //Column 0's west neighbour is the last column
+	out[last] &= packed.lastMask()
+}
+
+// shiftEast returns the row moved one cell west, so each cell holds its east neighbour, wrapping around the torus.
+func (packed *packedWorld) shiftEast(row, out []uint64) {
+	last := len(row) - 1
+	for i := 0; i < last; i++ {
+		out[i] = row[i]>>1 | row[i+1]<<63
+	}
+	out[last] = row[last]>>1 | (row[0]&1)<<((packed.width-1)%64) //The last column's east neighbour is column 0
+}
+
+// lastMask returns the bits of the last word of a row that hold cells.
+func (packed *packedWorld) lastMask() uint64 {
+	if packed.width%64 == 0 {
+		return ^uint64(0)
+	}
+	return 1<<(packed.width%64) - 1
+}
+
+// countMasks returns, for each neighbour count from 0 to 8, whether the rule makes dead and alive cells alive.
+func countMasks(rule Rule) (birth, survival uint16) {
+	for n := 0; n <= 8; n++ {
+		if rule.Birth[n] {
+			birth |= 1 << n
+		}
+		if rule.Survival[n] {
+			survival |= 1 << n
+		}
+	}
+	return birth, survival
+}
+
+// nextRows returns rows startY up to endY of the world after one turn.
+func (packed *packedWorld) nextRows(rule Rule, startY, endY int) [][]uint64 {
+	birth, survival := countMasks(rule)
+	height := len(packed.rows)
+	words := len(packed.rows[0])
+
+	planes := make([][]uint64, 8)
+	for i := range planes {
+		planes[i] = make([]uint64, words)
+	}
+
+	strip := make([][]uint64, endY-startY)
+	for y := startY; y < endY; y++ {
+		up := packed.rows[(y-1+height)%height]
+		mid := packed.rows[y]
+		down := packed.rows[(y+1)%height]
+		copy(planes[0], up)
+		copy(planes[1], down)
+		packed.shiftWest(up, planes[2])
+		packed.shiftEast(up, planes[3])
+		packed.shiftWest(mid, planes[4])
+		packed.shiftEast(mid, planes[5])
+		packed.shiftWest(down, planes[6])
+		packed.shiftEast(down, planes[7])
+
+		next := make([]uint64, words)
+		for i := range next {
+			//Add the 8 neighbour planes into a 4 bit count per cell, one bit of the count in each word
+			var s0, s1, s2, s3 uint64
+			for _, plane := range planes {
+				carry0 := s0 & plane[i]
+				s0 ^= plane[i]
+				carry1 := s1 & carry0
+				s1 ^= carry0
+				s3 |= s2 & carry1
+				s2 ^= carry1
+			}
+
+			var born, survives uint64
+			for n := 0; n <= 8; n++ {
+				if (birth|survival)&(1<<n) == 0 {
+					continue
+				}
+				match := countBit(s0, n&1) & countBit(s1, n&2) & countBit(s2, n&4) & countBit(s3, n&8)
+				if birth&(1<<n) != 0 {
+					born |= match
+				}
+				if survival&(1<<n) != 0 {
+					survives |= match
+				}
+			}
+			next[i] = born&^mid[i] | survives&mid[i]
+		}
+		next[words-1] &= packed.lastMask()
+		strip[y-startY] = next
+	}
+	return strip
+}
+
+// countBit returns the cells whose count has the bit set, if set is non-zero, or clear otherwise.
+func countBit(word uint64, set int) uint64 {
+	if set != 0 {
+		return word
+	}
+	return ^word
+}
+
+// packedEngine runs the rule on packed rows, and keeps a world of one byte per cell in step with them.
+type packedEngine struct {
+	p        Params
+	schedule []scheduledRule
+	packed   *packedWorld
+	world    [][]byte
+	turn     int
+	flipped  flipLog
+}
+
+func (e *packedEngine) Load(world [][]byte, turn int) {
+	e.world, e.turn = copyWorld(world), turn
+	e.packed = packWorld(e.world)
+	e.flipped = flipLog{}
+}
+
+// Step works out the next turn of the packed world between p.Threads workers, each taking a strip of rows.
+// It updates the world to match by flipping the cells that changed.
+func (e *packedEngine) Step(turns int) int {
+	rule := e.schedule[scheduledAt(e.schedule, e.turn)].rule
+	packed := e.packed
+	next := &packedWorld{width: packed.width, rows: make([][]uint64, len(packed.rows))}
+
+	threads := e.p.Threads
+	if threads > len(packed.rows) {
+		threads = len(packed.rows)
+	}
+	if threads < 1 {
+		threads = 1
+	}
+	done := make(chan bool)
+	for i := 0; i < threads; i++ {
+		startY := len(packed.rows) * i / threads
+		endY := len(packed.rows) * (i + 1) / threads
+		go func() {
+			copy(next.rows[startY:endY], packed.nextRows(rule, startY, endY))
+			done <- true
+		}()
+	}
+	for i := 0; i < threads; i++ {
+		<-done
+	}
+
+	var cells []util.Cell
+	var states []byte
+	for y, row := range next.rows {
+		for i, word := range row {
+			for changed := word ^ packed.rows[y][i]; changed != 0; changed &= changed - 1 {
+				x := i*64 + bits.TrailingZeros64(changed)
+				e.world[y][x] ^= alive
+				cells = append(cells, util.Cell{X: x, Y: y})
+				states = append(states, e.world[y][x])
+			}
+		}
+	}
+	e.flipped.add(cells, states)
+
+	e.packed = next
+	e.turn++
+	return 1
+}
+
+func (e *packedEngine) Alive() []util.Cell {
+	return calculateAliveCells(e.p, e.schedule[scheduledAt(e.schedule, e.turn)].rule, e.world)
+}
+
+func (e *packedEngine) Flipped() ([]util.Cell, []byte) {
+	return e.flipped.take()
+}
+
+func (e *packedEngine) Snapshot() [][]byte {
+	return copyWorld(e.world)
+}
+
+// current returns the byte world kept alongside the packed rows, without copying it.
+func (e *packedEngine) current() [][]byte {
+	return e.world
+}
+
+func (e *packedEngine) Stop() {}
@@ -0,0 +1,70 @@
+package gol
+
+import "hash/fnv"
+
+// cycleHistory is how many turns of world hashes are kept, so the longest period a cycle can be found with.
+const cycleHistory = 1024
+
+// cycleDetector finds when the world repeats itself. It keeps a hash of the world after each of the last
+// cycleHistory turns, and when a hash comes round again it keeps a copy of the world and waits a period
+// to check the world really does repeat, so a collision between hashes can never cause a wrong jump.
+type cycleDetector struct {
+	hashes []uint64       // The hash of the world after turn t is at t % cycleHistory
+	turns  map[uint64]int // The last turn after which the world had each hash
+
+	candidate       [][]byte
+	candidateTurn   int
+	candidatePeriod int
+}
+
+func newCycleDetector() *cycleDetector {
+	return &cycleDetector{hashes: make([]uint64, cycleHistory), turns: make(map[uint64]int)}
+}
+
+// period records the world after the turn, and returns the period of the cycle it is in once the cycle is certain, or 0.
+func (d *cycleDetector) period(world [][]byte, turn int) int {
+	if d.candidate != nil && turn == d.candidateTurn+d.candidatePeriod {
+		if equalWorlds(world, d.candidate) {
+			return d.candidatePeriod
+		}
+		d.candidate = nil
+	}
+
+	hash := hashWorld(world)
+
+	if earlier, ok := d.turns[hash]; ok && turn-earlier <= cycleHistory && d.candidate == nil {
+		d.candidate = make([][]byte, len(world))
+		for y := range world {
+			d.candidate[y] = append([]byte(nil), world[y]...)
+		}
+		d.candidateTurn, d.candidatePeriod = turn, turn-earlier
+	}
+
+	//Forget the hash falling out of the history, unless the world has had it since
+	old := d.hashes[turn%cycleHistory]
+	if t, ok := d.turns[old]; ok && t == turn-cycleHistory {
+		delete(d.turns, old)
+	}
+	d.hashes[turn%cycleHistory] = hash
+	d.turns[hash] = turn
+	return 0
+}
+
+// hashWorld returns the FNV-1a hash of the cells of the world.
+func hashWorld(world [][]byte) uint64 {
+	h := fnv.New64a()
+	for _, row := range world {
+		_, _ = h.Write(row)
+	}
+	return h.Sum64()
+}
+
+// equalWorlds reports whether two worlds hold the same cells.
+func equalWorlds(a, b [][]byte) bool {
+	for y := range a {
+		if string(a[y]) != string(b[y]) {
+			return false
+		}
+	}
+	return true
+}
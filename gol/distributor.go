@@ -12,13 +12,17 @@ type distributorChannels struct {
 	ioCommand  chan<- ioCommand
 	ioIdle     <-chan bool
 	ioFilename chan<- string
+	ioSize     chan<- int
 	ioOutput   chan<- uint8
 	ioInput    <-chan uint8
 	keyPresses <-chan rune
 }
 
-// distributor divides the work between workers and interacts with other goroutines.
-func distributor(p Params, c distributorChannels) {
+// distributor loads the image into the engine selected by p and interacts with other goroutines, leaving the
+// computation of each turn to the engine. It tells the GUI of each rule in the schedule at the start of the rule's turn.
+func distributor(p Params, schedule []scheduledRule, c distributorChannels) {
+	rule := schedule[0].rule
+	nextRule := 1
 	quit := make(chan bool)
 	quitComputation := make(chan bool)
 	turn := 0
@@ -31,12 +35,43 @@ func distributor(p Params, c distributorChannels) {
 	for i := range world {
 		world[i] = make([]byte, p.ImageWidth)
 	}
+	var shaded []util.Cell
+	var shades []uint8
 	for y := 0; y < p.ImageHeight; y++ {
 		for x := 0; x < p.ImageWidth; x++ {
 			world[y][x] = <-c.ioInput
-			if world[y][x] == 255 {c.events<-CellFlipped{0, util.Cell{x, y}}}
+			if rule.States > 2 {
+				if world[y][x] != dead {
+					shaded = append(shaded, util.Cell{X: x, Y: y})
+					shades = append(shades, rule.shade(world[y][x]))
+				}
+			} else if world[y][x] == alive {c.events<-CellFlipped{0, util.Cell{x, y}}}
 		}
 	}
+	if rule.States > 2 {
+		c.events <- CellsShaded{0, shaded, shades}
+	}
+
+	engine := newEngine(p, schedule, c.events)
+	engine.Load(world, turn)
+	defer engine.Stop()
+	var cycles *cycleDetector
+	worlds, hasWorld := engine.(worldEngine)
+	if hasWorld && p.DetectCycles {
+		cycles = newCycleDetector() //The sparse engine's plane is unbounded, and HashLife jumps many turns at once
+		cycles.period(world, turn)
+	}
+	var reference Engine
+	if isVerifying(p) {
+		reference, _ = NewEngine(verifyParams(p)) //Already checked with the schedule
+		reference.Load(world, turn)
+		defer reference.Stop()
+	}
+	stats, hasStats := engine.(statsEngine)
+	output := func() {
+		outputPgm(c, engine.Snapshot(), turn)
+	}
+	aliveCells := engine.Alive
 
 	c.events <- StateChange{turn, Executing}
 
@@ -49,10 +84,10 @@ func distributor(p Params, c distributorChannels) {
 			case x := <-c.keyPresses:
 				if x == 's' {
 					if isPaused == true {
-						outputPgm(c, world, p, turn)
+						output()
 					} else if isPaused == false {
 						mutex.Lock()
-						outputPgm(c, world, p, turn)
+						output()
 						mutex.Unlock()
 					}
 				}
@@ -91,7 +126,10 @@ func distributor(p Params, c distributorChannels) {
 					return
 				case <-ticker.C:
 					mutex.Lock()
-					c.events <- AliveCellsCount{turn, len(calculateAliveCells(p, world))}
+					c.events <- AliveCellsCount{turn, len(aliveCells())}
+					if hasStats {
+						c.events <- WorkerStats{turn, stats.stats()}
+					}
 					mutex.Unlock()
 				}
 			}
@@ -99,15 +137,49 @@ func distributor(p Params, c distributorChannels) {
 	}()
 
 	func() {
-		for i := 0; i < p.Turns; i++ {
+		for turn < p.Turns {
 			select {
 			case <-quitComputation:
 				return
 			default:
 				mutex.Lock()
-				world = calculateNextState(p, world, c, turn) //Iterate through all turns
-				turn++
+				if nextRule < len(schedule) && schedule[nextRule].fromTurn == turn {
+					rule = schedule[nextRule].rule
+					nextRule++
+					c.events <- RuleChanged{turn, rule.String()}
+				}
+				steps := p.Turns - turn
+				if reference != nil {
+					steps = 1 //Compare the worlds after every turn
+				}
+				turns := engine.Step(steps) //Engines never step past the next rule in the schedule
+				cells, states := engine.Flipped() //Only cells the engine's workers have not sent themselves
+				sendFlipped(c.events, rule, turn, cells, states)
+				turn += turns
 				c.events <- TurnComplete{turn}
+				if reference != nil {
+					reference.Step(1)
+					reference.Flipped() //Only the engine being verified is drawn
+					if event, diverged := divergence(p, c, rule, engine, reference, turn); diverged {
+						c.events <- event
+						mutex.Unlock()
+						return
+					}
+				}
+				if cycles != nil && nextRule == len(schedule) && !dependsOnTurn(rule) {
+					world := worlds.current() //Hashed where it is, so no copy is made unless it may start a cycle
+					if period := cycles.period(world, turn); period > 0 {
+						c.events <- CycleDetected{turn, period}
+						if skipped := (p.Turns - turn) / period * period; skipped > 0 {
+							turn += skipped //Whole periods leave the world as it is
+							engine.Load(world, turn)
+							if reference != nil {
+								reference.Load(world, turn)
+							}
+						}
+						cycles = nil
+					}
+				}
 				mutex.Unlock()
 			}
 		}
@@ -116,17 +188,20 @@ func distributor(p Params, c distributorChannels) {
 	quit <- true
 
 	mutex.Lock()
-	outputPgm(c, world, p, turn)
+	output()
 	mutex.Unlock()
 
 	c.ioCommand <- ioCheckIdle
 	<-c.ioIdle
 
 	mutex.Lock()
-	alive := calculateAliveCells(p, world)
+	finalAlive := aliveCells()
+	if hasStats {
+		c.events <- WorkerStats{turn, stats.stats()}
+	}
 	mutex.Unlock()
 
-	c.events <- FinalTurnComplete{turn, alive} //Uses FinalTurnComplete with calculateAliveCells
+	c.events <- FinalTurnComplete{turn, finalAlive} //Uses FinalTurnComplete with calculateAliveCells
 
 	// Make sure that the Io has finished any output before exiting.
 	c.ioCommand <- ioCheckIdle
@@ -138,130 +213,187 @@ func distributor(p Params, c distributorChannels) {
 	close(c.events)
 }
 
-func calculateNextState(p Params, world [][]byte, c distributorChannels, turn int) [][]byte {
-
-	var alive []util.Cell                  //Make a slice of alive cells
-	newWorld := make([][]byte, p.ImageHeight)
-	for i := range newWorld {
-		newWorld[i] = make([]byte, p.ImageWidth)
-	}						//Make a new world to return
-	//copy(newWorld, world)                  //Copy world to newWorld
+// worldEngine is an engine keeping the world as one byte per cell of the image, as the dense and bit-packed engines do.
+type worldEngine interface {
+	// current returns the engine's own world, which must not be written to and is only valid until the next step.
+	current() [][]byte
+}
 
-	var channels []chan []util.Cell
+// statsEngine is an engine whose workers report how busy they have been, as the dense engine's do.
+type statsEngine interface {
+	stats() []WorkerStat
+}
 
-	if p.Threads == 1 {
-		for y := 0; y < p.ImageHeight; y++ { //Iterate through all rows
-			for x := 0; x < p.ImageWidth; x++ { //Iterate through all columns
-				aliveNeighbours := aliveNeighbours(p, world, x, y) //Count alive neighbours using the function
-				if shouldCellBeAlive(x, y, world, aliveNeighbours) {
-					alive = append(alive, util.Cell{x, y})
-				}
-			}
+// sendFlipped sends the GUI the cells that changed on the turn, as CellsShaded if the rule has more than two states
+// or CellsFlipped otherwise. Workers send their own cells at the same time, and nothing is sent if no cell changed.
+func sendFlipped(events chan<- Event, rule Rule, turn int, cells []util.Cell, states []byte) {
+	if len(cells) == 0 {
+		return
+	}
+	if rule.States > 2 {
+		shades := make([]uint8, len(states))
+		for i, state := range states {
+			shades[i] = rule.shade(state)
 		}
+		events <- CellsShaded{turn, cells, shades}
 	} else {
-		for i := 0; i < p.Threads; i++ {
-			startHeight := (p.ImageHeight / p.Threads) * i
-			endHeight := ((p.ImageHeight / p.Threads) * (i + 1)) + p.ImageHeight % p.Threads
-			out := make(chan []util.Cell)
-			channels = append(channels, out)
-
-			go worker(startHeight, endHeight, p.ImageWidth, world, p, out)
-		}
+		events <- CellsFlipped{turn, cells}
+	}
+}
 
-		for j := 0; j < len(channels); j++ {
-			alive = append(alive, <-channels[j]...)
-		}
+// nextStrip returns rows startY up to endY of the world after one turn.
+// Probabilistic rules use the random stream of each row for the turn, so the result does not depend on the strips.
+// If the world is split into regions, each cell follows the rule of its region.
+func nextStrip(p Params, rule Rule, world [][]byte, turn, startY, endY int) [][]byte {
+	strip := make([][]byte, endY-startY)
+	for i := range strip {
+		strip[i] = make([]byte, p.ImageWidth)
 	}
+	nextArea(p, rule, world, turn, 0, p.ImageWidth, startY, endY, strip)
+	return strip
+}
 
-	for y := 0; y < p.ImageHeight; y++ {
-		for x := 0; x < p.ImageWidth; x++ {
-			newWorld[y][x] = 0 //Reset newWorld to be 0 across the board
-		}
+// nextArea writes columns startX up to endX of rows startY up to endY of the world after one turn into out,
+// whose first row is row startY, leaving its other columns alone.
+func nextArea(p Params, rule Rule, world [][]byte, turn, startX, endX, startY, endY int, out [][]byte) {
+	if rule.lookup != nil {
+		lookupArea(p, rule, world, startX, endX, startY, endY, out)
+		return
 	}
 
-	for _, aliveCell := range alive {
-		newWorld[aliveCell.Y][aliveCell.X] = 255
-	} //For every cell that should be alive, set it to a value of 255
+	rules := []Rule{rule}
+	var regions [][]int
+	if rule.regions != nil {
+		rules, regions = rule.regions.rules, rule.regions.cells
+	}
 
-	var flippedCells []util.Cell
+	counts := make([][][]int, len(rules))
+	for i, r := range rules {
+		if r.Range > 1 || r.Neighbourhood == Circular {
+			counts[i] = rangeNeighbours(p, r, world, startX, endX, startY, endY) //Larger than Life neighbourhoods are counted for the whole area at once
+		}
+	}
 
-	for y := 0; y < p.ImageHeight; y++ {
-		for x := 0; x < p.ImageWidth; x++ {
-			if world[y][x] != newWorld[y][x] {
-				flippedCells = append(flippedCells, util.Cell{x, y})
+	for y := startY; y < endY; y++ { //Iterate through all rows
+		var random rowRandom
+		if rule.probabilistic() {
+			random = newRowRandom(p.Seed, turn, y)
+		}
+		for x := startX; x < endX; x++ { //Iterate through all columns
+			i := 0
+			if regions != nil {
+				i = regions[y][x]
+			}
+			neighbours := -1
+			if counts[i] != nil {
+				neighbours = counts[i][y-startY][x-startX]
 			}
+			out[y-startY][x] = nextCell(p, rules[i], world, turn, x, y, neighbours, random)
 		}
 	}
+}
 
-	c.events<- CellsFlipped{turn, flippedCells}
+// nextCell returns the state of the cell at (x, y) after one turn.
+// neighbours is the cell's neighbour count for rules counted by rangeNeighbours, and -1 otherwise.
+func nextCell(p Params, rule Rule, world [][]byte, turn, x, y int, neighbours int, random rowRandom) byte {
+	if rule.table != nil {
+		return rule.table.next(p, rule.topology, world, x, y) //Rule tables give the next state directly
+	}
+	if rule.margolus != nil {
+		return margolusNext(p, rule.margolus, world, turn, x, y)
+	}
 
-	return newWorld
-}
+	state := world[y][x]
+	if state > alive {
+		return byte((int(state) + 1) % rule.States) //Decaying cells ignore their neighbours
+	}
 
-func shouldCellBeAlive(x, y int, world [][]byte, aliveNeighbours int) bool {
-	if world[y][x] == 255 && (aliveNeighbours == 2 || aliveNeighbours == 3) {
-		return true
-	} else if world[y][x] == 0 && aliveNeighbours == 3 {
-		return true
+	var aliveNextTurn bool
+	if rule.transitions != nil {
+		aliveNextTurn = rule.transitions[neighbourhoodIndex(p, rule.topology, world, x, y)] //Isotropic rules look up the whole 3x3 configuration
 	} else {
-		return false
+		if neighbours < 0 {
+			neighbours = aliveNeighbours(p, rule, world, x, y) //Count alive neighbours using the function
+		}
+		if rule.Middle && state == alive {
+			neighbours++
+		}
+		aliveNextTurn = shouldCellBeAlive(rule, state, neighbours)
+	}
+	if aliveNextTurn && rule.probabilistic() {
+		miss := rule.BirthMiss
+		if state == alive {
+			miss = rule.SurvivalMiss
+		}
+		aliveNextTurn = random.at(x) >= miss
 	}
+	return nextState(rule, state, aliveNextTurn)
 }
 
-func worker(startY, endY, endX int, world [][]byte, p Params, out chan<- []util.Cell) {
-	var aliveNextTurn []util.Cell
-
-	for y := startY; y < endY; y++ {
-		for x := 0; x < endX; x++ {
-			aliveNeighbours := aliveNeighbours(p, world, x, y) //Count alive neighbours using the function
-			if shouldCellBeAlive(x, y, world, aliveNeighbours) {
-				aliveNextTurn = append(aliveNextTurn, util.Cell{x, y})
-			}
-
-		}
+// nextState returns the state after one turn of a dead or alive cell, given whether the rule makes it alive.
+func nextState(rule Rule, state byte, aliveNextTurn bool) byte {
+	if aliveNextTurn {
+		return alive
 	}
+	if state == alive && rule.States > 2 {
+		return alive + 1 //Start decaying
+	}
+	return dead
+}
 
-	out <- aliveNextTurn
+func shouldCellBeAlive(rule Rule, state byte, aliveNeighbours int) bool {
+	if state == alive {
+		return rule.Survival[aliveNeighbours]
+	}
+	return rule.Birth[aliveNeighbours]
 }
 
-func aliveNeighbours(p Params, world [][]byte, x int, y int) int {
+func aliveNeighbours(p Params, rule Rule, world [][]byte, x int, y int) int {
 	sum := 0
 
-	for i := -1; i <= 1; i++ {
-		for j := -1; j <= 1; j++ {
-			if i == 0 && j == 0 {
-				continue
-			}
-			ny := (y + i + p.ImageHeight) % p.ImageHeight
-			nx := (x + j + p.ImageWidth) % p.ImageWidth
-			if world[ny][nx] == 255 {
-				sum++
-			}
+	for _, o := range rule.Neighbourhood.offsets(y) {
+		if rule.topology.cell(p, world, x+o.dx, y+o.dy) == alive {
+			sum++
 		}
 	}
 
 	return sum //Return sum of alive neighbours
 }
 
-func calculateAliveCells(p Params, world [][]byte) []util.Cell {
-	var alive []util.Cell
+func calculateAliveCells(p Params, rule Rule, world [][]byte) []util.Cell {
+	var aliveCells []util.Cell
 	for y := 0; y < p.ImageHeight; y++ {
 		for x := 0; x < p.ImageWidth; x++ {
-			if world[y][x] == 255 {
-				alive = append(alive, util.Cell{X: x, Y: y})
+			if rule.isAlive(world[y][x]) {
+				aliveCells = append(aliveCells, util.Cell{X: x, Y: y})
 			}
 		}
 	}
-	return alive
+	return aliveCells
+}
+
+// outputPgm writes the world to a pgm file named after its size and the turn.
+func outputPgm(c distributorChannels, world [][]byte, turn int) {
+	height, width := len(world), 0
+	if height > 0 {
+		width = len(world[0])
+	}
+	writePgm(c, world, strconv.Itoa(width)+"x"+strconv.Itoa(height)+"x"+strconv.Itoa(turn), turn)
 }
 
-func outputPgm(c distributorChannels, world [][]byte, p Params, turn int) {
-	filename := strconv.Itoa(p.ImageWidth) + "x" + strconv.Itoa(p.ImageHeight) + "x" + strconv.Itoa(turn)
+// writePgm writes the world after the turn to a pgm file with the filename.
+func writePgm(c distributorChannels, world [][]byte, filename string, turn int) {
+	height, width := len(world), 0
+	if height > 0 {
+		width = len(world[0])
+	}
 	c.ioCommand <- ioOutput
 	c.ioFilename <- filename
+	c.ioSize <- width
+	c.ioSize <- height
 
-	for y := 0; y < p.ImageHeight; y++ {
-		for x := 0; x < p.ImageWidth; x++ {
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
 			c.ioOutput <- world[y][x]
 		}
 	}
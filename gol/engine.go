@@ -0,0 +1,160 @@
+package gol
+
+import "uk.ac.bris.cs/gameoflife/util"
+
+// Engine computes the turns of the Game of Life. The distributor loads an engine with the image, asks it for turns
+// and tells the GUI what changed, while it keeps the keyboard, ticker and io to itself, so one engine can be swapped
+// for another without touching them. Worlds are indexed [y][x] and hold the states of a rule: 0 for dead, 1 for
+// alive, and 2 and up for the decaying states of Generations rules. An engine is only used by one goroutine at a time.
+type Engine interface {
+	// Load replaces the engine's world with a copy of world, taking it to be the world after turn turns.
+	Load(world [][]byte, turn int)
+	// Step computes at least one and at most turns turns, and returns how many it computed. Engines working a turn
+	// at a time compute one, while HashLife jumps as many as it can at once. A step never goes past the turn a rule
+	// of the schedule takes over.
+	Step(turns int) int
+	// Alive returns the alive cells. On the sparse engine's plane they may lie outside the image.
+	Alive() []util.Cell
+	// Flipped returns the cells of the image that changed since the last call, or since the world was loaded,
+	// with the states they changed to. A cell that changed more than once is given once for each change, in order.
+	Flipped() ([]util.Cell, []byte)
+	// Snapshot returns a copy of the world. The sparse engine returns the smallest area of its plane holding every
+	// cell that is not dead.
+	Snapshot() [][]byte
+	// Stop ends any goroutines the engine started. The engine cannot be used afterwards.
+	Stop()
+}
+
+// NewEngine returns the engine selected by p.Engine, running the rule or schedule of rules given by p.
+// It must be loaded with a world before its first step.
+func NewEngine(p Params) (Engine, error) {
+	schedule, err := newRuleSchedule(p)
+	if err != nil {
+		return nil, err
+	}
+	return newEngine(p, schedule, nil), nil
+}
+
+// newEngine returns the engine selected by p, running the schedule, which has already been checked against it.
+// If events is not nil, the dense engine's workers send the cells they flip to it themselves as they finish each
+// turn, rather than leaving them for Flipped, so the GUI hears of them without the cells being gathered first.
+func newEngine(p Params, schedule []scheduledRule, events chan<- Event) Engine {
+	switch {
+	case isSparse(p):
+		return &sparseEngine{p: p, schedule: schedule}
+	case isBitPacked(p):
+		return &packedEngine{p: p, schedule: schedule}
+	case isHashLife(p):
+		return &hashEngine{p: p, schedule: schedule, ruleIndex: -1}
+	default:
+		return &denseEngine{p: p, schedule: schedule, events: events}
+	}
+}
+
+// scheduledAt returns the index of the rule of the schedule that runs on the turn.
+func scheduledAt(schedule []scheduledRule, turn int) int {
+	i := 0
+	for i+1 < len(schedule) && schedule[i+1].fromTurn <= turn {
+		i++
+	}
+	return i
+}
+
+// copyWorld returns a copy of world, with every row sharing one allocation.
+func copyWorld(world [][]byte) [][]byte {
+	if len(world) == 0 {
+		return nil
+	}
+	width := len(world[0])
+	cells := make([]byte, len(world)*width)
+	copied := make([][]byte, len(world))
+	for y := range world {
+		copied[y] = cells[y*width : (y+1)*width : (y+1)*width]
+		copy(copied[y], world[y])
+	}
+	return copied
+}
+
+// flipLog collects the cells that changed between calls to Flipped.
+type flipLog struct {
+	cells  []util.Cell
+	states []byte
+}
+
+// add records cells that changed, keeping the slices themselves if nothing is waiting to be collected.
+func (l *flipLog) add(cells []util.Cell, states []byte) {
+	if l.cells == nil {
+		l.cells, l.states = cells, states
+		return
+	}
+	l.cells = append(l.cells, cells...)
+	l.states = append(l.states, states...)
+}
+
+// take returns the cells recorded since the last call and forgets them.
+func (l *flipLog) take() ([]util.Cell, []byte) {
+	cells, states := l.cells, l.states
+	l.cells, l.states = nil, nil
+	return cells, states
+}
+
+// denseEngine is the reference engine, which every other engine has to agree with. It keeps the world as one byte
+// per cell of the image and computes each turn between p.Threads workers, using the parallel strategy and
+// evaluator selected by p, so it can run every rule, topology and mask.
+type denseEngine struct {
+	p        Params
+	schedule []scheduledRule
+	world    [][]byte
+	turn     int
+	workers  parallelStrategy
+	flipped  flipLog
+	events   chan<- Event // Where the workers send the cells they flip, or nil to keep them for Flipped
+}
+
+// Load copies the world and starts workers for it, stopping any that worked on an earlier world.
+func (e *denseEngine) Load(world [][]byte, turn int) {
+	e.Stop()
+	e.world, e.turn = copyWorld(world), turn
+	e.flipped = flipLog{}
+	e.workers = newParallelStrategy(e.p, e.schedule, e.world) //The workers last until the next world is loaded
+}
+
+// Step computes one turn.
+func (e *denseEngine) Step(turns int) int {
+	rule := e.schedule[scheduledAt(e.schedule, e.turn)].rule
+	var cells []util.Cell
+	var states []byte
+	e.world, cells, states = e.workers.step(rule, e.world, e.turn, e.events)
+	e.flipped.add(cells, states)
+	e.turn++
+	return 1
+}
+
+func (e *denseEngine) Alive() []util.Cell {
+	return calculateAliveCells(e.p, e.schedule[scheduledAt(e.schedule, e.turn)].rule, e.world)
+}
+
+func (e *denseEngine) Flipped() ([]util.Cell, []byte) {
+	return e.flipped.take()
+}
+
+func (e *denseEngine) Snapshot() [][]byte {
+	return copyWorld(e.world)
+}
+
+// current returns the world without copying it.
+func (e *denseEngine) current() [][]byte {
+	return e.world
+}
+
+func (e *denseEngine) Stop() {
+	if e.workers != nil {
+		e.workers.stop()
+		e.workers = nil
+	}
+}
+
+// stats returns how busy each worker has been since the last call.
+func (e *denseEngine) stats() []WorkerStat {
+	return e.workers.stats()
+}
@@ -2,6 +2,8 @@ package gol
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"uk.ac.bris.cs/gameoflife/util"
 )
@@ -45,6 +47,50 @@ type StateChange struct { // implements Event
 	NewState       State
 }
 
+// `RuleChanged` is an Event notifying the user that a rule schedule has switched to a new rule.
+// This Event is sent before any of the cells of the first turn using the new rule are flipped.
+type RuleChanged struct { // implements Event
+	CompletedTurns int
+	Rule           string
+}
+
+// `CycleDetected` is an Event notifying the user that the world after Turn completed turns is the same as it was
+// Period turns before, so it will repeat itself forever. The distributor then skips whole periods to the last turn,
+// so the next events are for a turn nearly as far as Turns, with the cells they would have after the full computation.
+// This Event is only sent if DetectCycles is set, and never by the sparse and HashLife engines.
+type CycleDetected struct { // implements Event
+	Turn   int
+	Period int
+}
+
+// `WorkerStats` is an Event notifying the user how busy each of the dense engine's workers has been.
+// This Event is sent with every `AliveCellsCount`, covering the time since the last `WorkerStats`, and once more
+// before `FinalTurnComplete`. It is not sent by the other engines.
+type WorkerStats struct { // implements Event
+	CompletedTurns int
+	Workers        []WorkerStat
+}
+
+// `Divergence` is an Event notifying the user that the engine being verified and the engine it is verified against
+// hold different worlds after CompletedTurns turns. Cells are the cells whose states differ. On boards of up to 16x16
+// cells, Board draws the alive cells of both engines side by side; on larger ones, Filename names a pgm image in out/
+// with the differing cells in white. The distributor computes no more turns after sending it.
+type Divergence struct { // implements Event
+	CompletedTurns int
+	Engine         string
+	Against        string
+	Cells          []util.Cell
+	Board          string
+	Filename       string
+}
+
+// WorkerStat is how one worker spent the time covered by a `WorkerStats` event.
+type WorkerStat struct {
+	Busy        time.Duration // Time spent working out cells, rather than waiting for other workers or the distributor
+	Utilisation float64       // Busy as a share of the time covered, from 0 to 1
+	Steals      int           // How many times the worker stole tiles from another worker, with the stealing strategy
+}
+
 // `CellFlipped` is an Event notifying the GUI about a change of state of a single cell.
 // This event should be sent every time a cell changes state.
 // Make sure to send this event for all cells that are alive when the image is loaded in.
@@ -63,9 +109,19 @@ type CellsFlipped struct { // implements Event
 	Cells          []util.Cell
 }
 
+// `CellsShaded` is an Event notifying the GUI about cells changing to a new state under a rule with more than two states.
+// Shades[i] is the grey level to draw the new state of Cells[i] with.
+// It is sent instead of `CellFlipped` and `CellsFlipped` when the rule has more than two states,
+// including once for all non-dead cells when the image is loaded in.
+type CellsShaded struct { // implements Event
+	CompletedTurns int
+	Cells          []util.Cell
+	Shades         []uint8
+}
+
 // `TurnComplete` is an Event notifying the GUI about turn completion.
 // SDL will render a frame when this event is sent.
-// All `CellFlipped` or `CellsFlipped` events must be sent *before* `TurnComplete`.
+// All `CellFlipped`, `CellsFlipped` or `CellsShaded` events must be sent *before* `TurnComplete`.
 type TurnComplete struct { // implements Event
 	CompletedTurns int
 }
@@ -73,6 +129,7 @@ type TurnComplete struct { // implements Event
 // `FinalTurnComplete` is an Event notifying the testing framework about the new world state after execution finished.
 // The data included with this Event is used directly by the tests.
 // SDL closes the window when this Event is sent.
+// With the sparse engine, Alive holds every alive cell of the plane, so coordinates may be negative or beyond the image.
 type FinalTurnComplete struct {
 	CompletedTurns int
 	Alive          []util.Cell
@@ -117,6 +174,52 @@ func (event ImageOutputComplete) GetCompletedTurns() int {
 	return event.CompletedTurns
 }
 
+func (event RuleChanged) String() string {
+	return fmt.Sprintf("Rule Changed to %v", event.Rule)
+}
+
+func (event RuleChanged) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
+func (event CycleDetected) String() string {
+	return fmt.Sprintf("Cycle Detected with period %v", event.Period)
+}
+
+func (event CycleDetected) GetCompletedTurns() int {
+	return event.Turn
+}
+
+func (event WorkerStats) String() string {
+	var b strings.Builder
+	b.WriteString("Worker Utilisation")
+	steals := 0
+	for _, worker := range event.Workers {
+		fmt.Fprintf(&b, " %.0f%%", worker.Utilisation*100)
+		steals += worker.Steals
+	}
+	if steals > 0 {
+		fmt.Fprintf(&b, ", %v Steals", steals)
+	}
+	return b.String()
+}
+
+func (event WorkerStats) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
+func (event Divergence) String() string {
+	s := fmt.Sprintf("Divergence of %v from %v in %v cells", event.Engine, event.Against, len(event.Cells))
+	if event.Filename != "" {
+		return s + ", see out/" + event.Filename + ".pgm"
+	}
+	return s + "\n" + event.Board
+}
+
+func (event Divergence) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
 func (event CellFlipped) String() string {
 	return ""
 }
@@ -133,6 +236,14 @@ func (event CellsFlipped) GetCompletedTurns() int {
 	return event.CompletedTurns
 }
 
+func (event CellsShaded) String() string {
+	return ""
+}
+
+func (event CellsShaded) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
 func (event TurnComplete) String() string {
 	return ""
 }
@@ -1,21 +1,55 @@
 package gol
 
+import "uk.ac.bris.cs/gameoflife/util"
+
 // Params provides the details of how to run the Game of Life and which image to load.
 type Params struct {
-	Turns       int
-	Threads     int
-	ImageWidth  int
-	ImageHeight int
+	Turns         int
+	Threads       int
+	ImageWidth    int
+	ImageHeight   int
+	Rule          string  // Life-like, Generations or Larger than Life rulestring, e.g. "B36/S23" or "B2/S/C3". Defaults to DefaultRule.
+	Neighbourhood string  // "moore", "vonneumann" or "hex" for Life-like rules. Defaults to the rule's own neighbourhood.
+	Topology      string  // "torus", "bounded", "mirror" or a Golly bounded grid such as "K512*,512". Defaults to "torus".
+	RuleFile      string  // Path of a Golly .rule file with a @TABLE section, used instead of Rule if set.
+	BirthMiss     float64 // Probability that a birth called for by the rule does not happen. Defaults to 0.
+	SurvivalMiss  float64 // Probability that a survival called for by the rule does not happen, e.g. 0.01 for 1% random death.
+	Seed          int64   // Seed for the random numbers used when BirthMiss or SurvivalMiss are set.
+
+	Schedule []ScheduleEntry // Rules to switch to at later turns, in increasing turn order.
+	Mask     string          // Path of a pgm image the size of the world, splitting it into regions by grey level.
+	Palette  []Region        // Rules of the regions of Mask. Cells of any other grey level follow Rule.
+	Engine   string          // "dense", "bitpacked" or "hashlife" for the ImageWidth x ImageHeight world, or "sparse" for an unbounded plane. Defaults to "dense".
+	Strategy string          // How the dense engine's workers share the world: "shared" memory, "stealing" tiles from each other's shares or "halo" exchange over channels. Defaults to "shared".
+
+	Lookup     bool // Whether the dense engine looks up the next state of each cell in a table generated from a two state rule of a 3x3 neighbourhood.
+	TileWidth  int  // Width of the tiles shared-memory workers take from their work queue. Defaults to 4, or 4 times the range of Larger than Life rules.
+	TileHeight int  // Height of the tiles shared-memory workers take from their work queue. Defaults like TileWidth. With TileWidth set to ImageWidth, the tiles are strips of rows.
+
+	DetectCycles  bool   // Whether the dense and bit-packed engines watch for the world repeating itself, and then skip whole periods to the last turn.
+	VerifyAgainst string // Engine to run in lockstep with Engine from the same image, stopping with a Divergence event on the first turn their worlds differ.
 }
 
 // Run starts the processing of Game of Life. It should initialise channels and goroutines.
+// Run panics if p does not describe a valid rule, so callers should check it with NewRule first.
 func Run(p Params, events chan<- Event, keyPresses <-chan rune) {
+	schedule, err := newRuleSchedule(p)
+	util.Check(err)
+	run(p, schedule, events, keyPresses)
+}
+
+// run starts the io goroutine and the distributor, which runs the rules of the schedule rather than those of p.
+// The io goroutine reads and writes every turn's cells as grey levels of the first rule, which newRuleSchedule
+// makes sure are the grey levels of every rule in the schedule by giving them all the same number of states.
+func run(p Params, schedule []scheduledRule, events chan<- Event, keyPresses <-chan rune) {
+	rule := schedule[0].rule
 
 	//	TODO: Put the missing channels in here.
 
 	ioCommand := make(chan ioCommand)
 	ioIdle := make(chan bool)
 	ioFilename := make(chan string)
+	ioSize := make(chan int)
 	ioInput := make(chan uint8)
 	ioOutput := make(chan uint8)
 
@@ -23,19 +57,21 @@ func Run(p Params, events chan<- Event, keyPresses <-chan rune) {
 		command:  ioCommand,
 		idle:     ioIdle,
 		filename: ioFilename,
+		size:     ioSize,
 		output:   ioOutput,
 		input:    ioInput,
 	}
-	go startIo(p, ioChannels)
+	go startIo(p, rule, ioChannels)
 
 	distributorChannels := distributorChannels{
 		events:     events,
 		ioCommand:  ioCommand,
 		ioIdle:     ioIdle,
 		ioFilename: ioFilename,
+		ioSize:     ioSize,
 		ioOutput:  ioOutput,
 		ioInput:    ioInput,
 		keyPresses: keyPresses,
 	}
-	distributor(p, distributorChannels)
+	distributor(p, schedule, distributorChannels)
 }
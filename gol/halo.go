@@ -0,0 +1,252 @@
+package gol
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// The halo-exchange strategy runs the dense engine on workers that share no memory, so it could later be
+// spread across machines. Each worker owns a strip of rows and keeps ghost copies of the rows outside it
+// that its cells can reach. At the start of every turn it sends the rows it owns to the workers holding
+// ghosts of them, which are usually just its neighbours above and below, and waits for its own ghosts.
+// Every row crosses a channel as a copy, so no worker ever reads cells another worker writes.
+
+// isHalo reports whether p selects the halo-exchange strategy.
+func isHalo(p Params) bool {
+	return strings.EqualFold(strings.TrimSpace(p.Strategy), "halo")
+}
+
+// checkStrategy returns an error if p does not select a parallel strategy the engine can use.
+func checkStrategy(p Params) error {
+	if p.TileWidth < 0 || p.TileHeight < 0 {
+		return fmt.Errorf("invalid tile size %vx%v: expected positive numbers, or 0 for the default", p.TileWidth, p.TileHeight)
+	}
+	switch strings.ToLower(strings.TrimSpace(p.Strategy)) {
+	case "", "shared":
+		return nil
+	case "stealing", "halo":
+		if engine := strings.ToLower(strings.TrimSpace(p.Engine)); engine != "" && engine != "dense" {
+			return fmt.Errorf("the %v strategy only runs the dense engine, not %v", strings.TrimSpace(p.Strategy), p.Engine)
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid strategy %q: expected shared, stealing or halo", p.Strategy)
+	}
+}
+
+// haloPool runs the halo-exchange workers, which hold the world between turns.
+type haloPool struct {
+	workers []*haloWorker
+	results chan haloStrip
+	next    [][]byte
+	since   time.Time // When the workers' stats were last taken
+}
+
+// haloJob asks a worker to compute a turn and send the cells of its strip that changed to events, if it is not nil.
+type haloJob struct {
+	rule   Rule
+	turn   int
+	events chan<- Event
+}
+
+// haloRow is a copy of row y sent to a worker holding a ghost of it.
+type haloRow struct {
+	y     int
+	cells []byte
+}
+
+// haloStrip is a copy of a worker's strip after a turn, sent back to the pool with the cells of it that changed
+// and their new states, unless the worker sent them to the GUI itself.
+type haloStrip struct {
+	startY int
+	rows   [][]byte
+	cells  []util.Cell
+	states []byte
+}
+
+// haloSend is a row a worker owns and the inbox of a worker holding a ghost of it.
+type haloSend struct {
+	y  int
+	to chan<- haloRow
+}
+
+// haloWorker owns rows startY up to endY. Its world is full height so cells can be found by their
+// position, but only the rows it owns and its ghost rows are allocated.
+type haloWorker struct {
+	p            Params
+	startY, endY int
+	world, next  [][]byte
+	ghosts       int
+	sends        []haloSend
+	inbox        chan haloRow
+	jobs         chan haloJob
+	busy         WorkerStat // How busy the worker has been since the stats were last taken
+}
+
+// newHaloPool splits the world between p.Threads workers, or one per row if the image has fewer rows,
+// giving each its strip and ghosts of every row that a cell of the strip can reach under any rule in the schedule.
+func newHaloPool(p Params, schedule []scheduledRule, world [][]byte) *haloPool {
+	threads := p.Threads
+	if threads > p.ImageHeight {
+		threads = p.ImageHeight
+	}
+	if threads < 1 {
+		threads = 1
+	}
+
+	reach := 1
+	for _, scheduled := range schedule {
+		if r := ruleReach(scheduled.rule); r > reach {
+			reach = r
+		}
+	}
+	topology := schedule[0].rule.topology
+
+	pool := &haloPool{results: make(chan haloStrip, threads), next: make([][]byte, p.ImageHeight), since: time.Now()}
+	owners := make([]*haloWorker, p.ImageHeight)
+	for i := 0; i < threads; i++ {
+		w := &haloWorker{
+			p:      p,
+			startY: p.ImageHeight * i / threads,
+			endY:   p.ImageHeight * (i + 1) / threads,
+			world:  make([][]byte, p.ImageHeight),
+			next:   make([][]byte, p.ImageHeight),
+			jobs:   make(chan haloJob),
+		}
+		for y := w.startY; y < w.endY; y++ {
+			w.world[y] = append([]byte(nil), world[y]...)
+			w.next[y] = make([]byte, p.ImageWidth)
+			owners[y] = w
+		}
+		pool.workers = append(pool.workers, w)
+	}
+
+	for _, w := range pool.workers {
+		rows := haloRows(p, topology, reach, w.startY, w.endY)
+		for _, y := range rows {
+			w.world[y] = append([]byte(nil), world[y]...)
+		}
+		w.ghosts = len(rows)
+		w.inbox = make(chan haloRow, len(rows)) //Buffered so that sending ghosts never waits for the receiver
+		for _, y := range rows {
+			owners[y].sends = append(owners[y].sends, haloSend{y, w.inbox})
+		}
+	}
+	for y := range pool.next {
+		pool.next[y] = make([]byte, p.ImageWidth)
+	}
+
+	for _, w := range pool.workers {
+		go w.run(pool.results)
+	}
+	return pool
+}
+
+// ruleReach returns how many rows away a cell's next state can depend on, under the rule or any of its regions' rules.
+func ruleReach(rule Rule) int {
+	rules := []Rule{rule}
+	if rule.regions != nil {
+		rules = rule.regions.rules
+	}
+	reach := 1 //Range 1 neighbourhoods, rule tables and Margolus blocks
+	for _, r := range rules {
+		if r.Range > reach {
+			reach = r.Range
+		}
+	}
+	return reach
+}
+
+// haloRows returns the rows outside startY up to endY that cells of the strip can reach.
+// Rows are found through the topology, since crossing a twisted or shifted edge can lead to a row far away.
+func haloRows(p Params, topology Topology, reach, startY, endY int) []int {
+	found := make(map[int]bool)
+	var rows []int
+	for y := startY - reach; y < endY+reach; y++ {
+		for x := -reach; x < p.ImageWidth+reach; x++ {
+			if x == reach && p.ImageWidth-reach > x {
+				x = p.ImageWidth - reach //Only crossing the left and right edges changes the row of columns in between
+			}
+			_, wy, ok := topology.wrap(p, x, y)
+			if ok && (wy < startY || wy >= endY) && !found[wy] {
+				found[wy] = true
+				rows = append(rows, wy)
+			}
+		}
+	}
+	return rows
+}
+
+// run computes the worker's strip for each job, sending the cells that changed, until the pool is stopped.
+func (w *haloWorker) run(results chan<- haloStrip) {
+	for job := range w.jobs {
+		for _, send := range w.sends {
+			send.to <- haloRow{send.y, append([]byte(nil), w.world[send.y]...)}
+		}
+		for i := 0; i < w.ghosts; i++ {
+			row := <-w.inbox
+			copy(w.world[row.y], row.cells)
+		}
+
+		start := time.Now()
+		nextArea(w.p, job.rule, w.world, job.turn, 0, w.p.ImageWidth, w.startY, w.endY, w.next[w.startY:w.endY])
+		cells, states := appendChanges(w.world, w.next, 0, w.p.ImageWidth, w.startY, w.endY, nil, nil)
+		w.busy.Busy += time.Since(start)
+		if job.events != nil {
+			sendFlipped(job.events, job.rule, job.turn, cells, states)
+			cells, states = nil, nil
+		}
+
+		strip := haloStrip{w.startY, make([][]byte, w.endY-w.startY), cells, states}
+		for y := w.startY; y < w.endY; y++ {
+			w.world[y], w.next[y] = w.next[y], w.world[y]
+			strip.rows[y-w.startY] = append([]byte(nil), w.world[y]...)
+		}
+		results <- strip
+	}
+}
+
+// step returns the world after one turn, gathered from the workers' strips. The workers hold their own copy of
+// the world, so the world given is only kept to gather a later turn into.
+func (pool *haloPool) step(rule Rule, world [][]byte, turn int, events chan<- Event) ([][]byte, []util.Cell, []byte) {
+	for _, w := range pool.workers {
+		w.jobs <- haloJob{rule, turn, events}
+	}
+	var cells []util.Cell
+	var states []byte
+	for range pool.workers {
+		strip := <-pool.results
+		for i, row := range strip.rows {
+			copy(pool.next[strip.startY+i], row)
+		}
+		cells = append(cells, strip.cells...)
+		states = append(states, strip.states...)
+	}
+
+	next := pool.next
+	pool.next = world
+	return next, cells, states
+}
+
+// stats returns how busy each worker has been since the last call. Waiting for ghost rows does not count as busy,
+// and workers never steal, as each always works out its own strip.
+func (pool *haloPool) stats() []WorkerStat {
+	busy := make([]WorkerStat, len(pool.workers))
+	for i, w := range pool.workers {
+		busy[i] = w.busy
+		w.busy = WorkerStat{}
+	}
+	stats := workerStats(busy, time.Since(pool.since))
+	pool.since = time.Now()
+	return stats
+}
+
+// stop ends the workers.
+func (pool *haloPool) stop() {
+	for _, w := range pool.workers {
+		close(w.jobs)
+	}
+}
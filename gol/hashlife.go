@@ -0,0 +1,287 @@
+package gol
+
+import (
+	"fmt"
+	"strings"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// The HashLife engine stores the world as a quadtree of canonical nodes, so identical squares anywhere in
+// the world, and at any turn, are the same node. The result of advancing a node (its centre square some
+// turns later) is memoized, so patterns that repeat themselves in space or time are only worked out once.
+//
+// The torus is run by embedding it in a universe tiled with copies of the world. Copies that line up with
+// the quadtree are identical nodes, so the universe can be large enough to advance the world by any power
+// of two turns at once while only storing a few nodes for each level above the world's size.
+
+// node is a square of 2^level x 2^level cells. Level 0 nodes are single cells.
+type node struct {
+	level          int
+	nw, ne, sw, se *node
+	state          byte
+}
+
+// quad is the key used to find the canonical node with the given quadrants.
+type quad struct {
+	nw, ne, sw, se *node
+}
+
+// resultKey is the key used to memoize the centre of a node after 2^step turns.
+type resultKey struct {
+	n    *node
+	step int
+}
+
+// hashLife holds the canonical nodes and memoized results for one rule.
+type hashLife struct {
+	rule    Rule
+	leaves  [256]*node
+	nodes   map[quad]*node
+	results map[resultKey]*node
+}
+
+// maxHashNodes is how many nodes are kept between jumps before the caches are cleared to free memory.
+const maxHashNodes = 1 << 22
+
+// isHashLife reports whether p selects the HashLife engine.
+func isHashLife(p Params) bool {
+	return strings.EqualFold(strings.TrimSpace(p.Engine), "hashlife")
+}
+
+// checkHashLife returns an error if the rule cannot be run by the HashLife engine.
+func checkHashLife(p Params, rule Rule) error {
+	switch {
+	case rule.Range != 1 || rule.margolus != nil:
+		return fmt.Errorf("the HashLife engine can only run rules with range 1 neighbourhoods, not %v", rule)
+	case rule.Neighbourhood == Hexagonal:
+		//Nodes are shared between rows of either parity, but odd rows of a hexagonal neighbourhood are offset
+		return fmt.Errorf("the HashLife engine cannot run hexagonal neighbourhoods")
+	case rule.regions != nil || rule.probabilistic():
+		return fmt.Errorf("the HashLife engine cannot run masks or probabilistic rules")
+	case !rule.topology.isTorus():
+		return fmt.Errorf("the HashLife engine tiles the world around a torus, so it cannot use topology %v", rule.topology)
+	}
+	return nil
+}
+
+func newHashLife(rule Rule) *hashLife {
+	h := &hashLife{rule: rule}
+	h.clear()
+	return h
+}
+
+// clear forgets every node and result.
+func (h *hashLife) clear() {
+	h.nodes = make(map[quad]*node)
+	h.results = make(map[resultKey]*node)
+	for state := range h.leaves {
+		h.leaves[state] = &node{state: byte(state)}
+	}
+}
+
+// join returns the canonical node with the given quadrants.
+func (h *hashLife) join(nw, ne, sw, se *node) *node {
+	key := quad{nw, ne, sw, se}
+	n, ok := h.nodes[key]
+	if !ok {
+		n = &node{level: nw.level + 1, nw: nw, ne: ne, sw: sw, se: se}
+		h.nodes[key] = n
+	}
+	return n
+}
+
+// centre returns the middle half of a node.
+func (h *hashLife) centre(n *node) *node {
+	return h.join(n.nw.se, n.ne.sw, n.sw.ne, n.se.nw)
+}
+
+// cell returns the state of the cell at (x, y) in the node.
+func (n *node) cell(x, y int) byte {
+	for n.level > 0 {
+		half := 1 << (n.level - 1)
+		switch {
+		case x < half && y < half:
+			n = n.nw
+		case y < half:
+			n, x = n.ne, x-half
+		case x < half:
+			n, y = n.sw, y-half
+		default:
+			n, x, y = n.se, x-half, y-half
+		}
+	}
+	return n.state
+}
+
+// successor returns the centre of a node of level 2 or more after 2^step turns, where step is at most level-2.
+func (h *hashLife) successor(n *node, step int) *node {
+	key := resultKey{n, step}
+	if result, ok := h.results[key]; ok {
+		return result
+	}
+
+	var result *node
+	if n.level == 2 {
+		result = h.base(n)
+	} else {
+		//The nine overlapping squares of half the size, in rows from the top left
+		n00, n01, n02 := n.nw, h.join(n.nw.ne, n.ne.nw, n.nw.se, n.ne.sw), n.ne
+		n10, n11, n12 := h.join(n.nw.sw, n.nw.se, n.sw.nw, n.sw.ne), h.centre(n), h.join(n.ne.sw, n.ne.se, n.se.nw, n.se.ne)
+		n20, n21, n22 := n.sw, h.join(n.sw.ne, n.se.nw, n.sw.se, n.se.sw), n.se
+
+		//Advance them half the turns, unless only their centres are needed to fit in a smaller step
+		advance := func(sub *node) *node {
+			if step == n.level-2 {
+				return h.successor(sub, n.level-3)
+			}
+			return h.centre(sub)
+		}
+		r00, r01, r02 := advance(n00), advance(n01), advance(n02)
+		r10, r11, r12 := advance(n10), advance(n11), advance(n12)
+		r20, r21, r22 := advance(n20), advance(n21), advance(n22)
+
+		next := step
+		if step == n.level-2 {
+			next = n.level - 3
+		}
+		result = h.join(
+			h.successor(h.join(r00, r01, r10, r11), next),
+			h.successor(h.join(r01, r02, r11, r12), next),
+			h.successor(h.join(r10, r11, r20, r21), next),
+			h.successor(h.join(r11, r12, r21, r22), next),
+		)
+	}
+	h.results[key] = result
+	return result
+}
+
+// base returns the centre 2x2 cells of a 4x4 node after one turn, using the rule like any other engine.
+func (h *hashLife) base(n *node) *node {
+	world := make([][]byte, 4)
+	for y := range world {
+		world[y] = make([]byte, 4)
+		for x := range world[y] {
+			world[y][x] = n.cell(x, y)
+		}
+	}
+	rule := h.rule
+	rule.topology = Topology{edges: bounded}
+	strip := nextStrip(Params{ImageWidth: 4, ImageHeight: 4}, rule, world, 0, 1, 3)
+	return h.join(h.leaves[strip[0][1]], h.leaves[strip[0][2]], h.leaves[strip[1][1]], h.leaves[strip[1][2]])
+}
+
+// tiled returns the node at the given level with its top left corner at (x, y) in the universe tiled with the world.
+// Squares are memoized by their position within the world, as every copy of it is the same node.
+func (h *hashLife) tiled(world [][]byte, memo map[[3]int]*node, level, x, y int) *node {
+	width, height := len(world[0]), len(world)
+	x, y = x%width, y%height
+	if level == 0 {
+		return h.leaves[world[y][x]]
+	}
+	key := [3]int{level, x, y}
+	if n, ok := memo[key]; ok {
+		return n
+	}
+	half := 1 << (level - 1)
+	n := h.join(
+		h.tiled(world, memo, level-1, x, y),
+		h.tiled(world, memo, level-1, x+half, y),
+		h.tiled(world, memo, level-1, x, y+half),
+		h.tiled(world, memo, level-1, x+half, y+half),
+	)
+	memo[key] = n
+	return n
+}
+
+// jump returns the world after 2^step turns.
+func (h *hashLife) jump(world [][]byte, step int) [][]byte {
+	width, height := len(world[0]), len(world)
+
+	//The centre of the universe, which is all that is left after the jump, has to cover the world
+	level := step + 2
+	for 1<<(level-1) < width || 1<<(level-1) < height {
+		level++
+	}
+	if len(h.nodes) > maxHashNodes {
+		h.clear()
+	}
+	universe := h.tiled(world, make(map[[3]int]*node), level, 0, 0)
+	result := h.successor(universe, step)
+
+	//The result's top left corner is a quarter of the universe in from the universe's top left
+	offset := 1 << (level - 2)
+	next := make([][]byte, height)
+	for y := range next {
+		next[y] = make([]byte, width)
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			next[(offset+y)%height][(offset+x)%width] = result.cell(x, y)
+		}
+	}
+	return next
+}
+
+// hashEngine jumps the world forwards with HashLife, starting afresh with each rule of the schedule.
+type hashEngine struct {
+	p         Params
+	schedule  []scheduledRule
+	hash      *hashLife
+	ruleIndex int // The index in the schedule of the rule hash runs
+	world     [][]byte
+	turn      int
+	flipped   flipLog
+}
+
+func (e *hashEngine) Load(world [][]byte, turn int) {
+	e.world, e.turn = copyWorld(world), turn
+	e.flipped = flipLog{}
+}
+
+// Step advances the world by the largest power of two turns that goes neither past turns turns nor past the next rule
+// of the schedule. The cells that changed are recorded as if they changed in one turn.
+func (e *hashEngine) Step(turns int) int {
+	i := scheduledAt(e.schedule, e.turn)
+	if i != e.ruleIndex {
+		e.hash, e.ruleIndex = newHashLife(e.schedule[i].rule), i
+	}
+	if i+1 < len(e.schedule) && e.schedule[i+1].fromTurn-e.turn < turns {
+		turns = e.schedule[i+1].fromTurn - e.turn
+	}
+	step := 0
+	for 1<<(step+1) <= turns {
+		step++
+	}
+	next := e.hash.jump(e.world, step)
+
+	var cells []util.Cell
+	var states []byte
+	for y := range e.world {
+		for x := range e.world[y] {
+			if e.world[y][x] != next[y][x] {
+				cells = append(cells, util.Cell{X: x, Y: y})
+				states = append(states, next[y][x])
+			}
+		}
+	}
+	e.flipped.add(cells, states)
+
+	e.world = next
+	e.turn += 1 << step
+	return 1 << step
+}
+
+func (e *hashEngine) Alive() []util.Cell {
+	return calculateAliveCells(e.p, e.schedule[scheduledAt(e.schedule, e.turn)].rule, e.world)
+}
+
+func (e *hashEngine) Flipped() ([]util.Cell, []byte) {
+	return e.flipped.take()
+}
+
+func (e *hashEngine) Snapshot() [][]byte {
+	return copyWorld(e.world)
+}
+
+func (e *hashEngine) Stop() {}
@@ -13,6 +13,7 @@ type ioChannels struct {
 	idle    chan<- bool
 
 	filename <-chan string
+	size     <-chan int
 	output   <-chan uint8
 	input    chan<- uint8
 }
@@ -20,6 +21,7 @@ type ioChannels struct {
 // ioState is the internal ioState of the io goroutine.
 type ioState struct {
 	params   Params
+	rule     Rule
 	channels ioChannels
 }
 
@@ -37,12 +39,13 @@ const (
 	ioCheckIdle
 )
 
-// writePgmImage receives an array of bytes and writes it to a pgm file.
+// writePgmImage receives an array of cell states and writes them to a pgm file as grey levels.
 func (io *ioState) writePgmImage() {
 	_ = os.Mkdir("out", os.ModePerm)
 
-	// Request a filename from the distributor.
+	// Request a filename and the image's width and height from the distributor.
 	filename := <-io.channels.filename
+	width, height := <-io.channels.size, <-io.channels.size
 
 	file, ioError := os.Create("out/" + filename + ".pgm")
 	util.Check(ioError)
@@ -50,30 +53,30 @@ func (io *ioState) writePgmImage() {
 
 	_, _ = file.WriteString("P5\n")
 	//_, _ = file.WriteString("# PGM file writer by pnmmodules (https://github.com/owainkenwayucl/pnmmodules).\n")
-	_, _ = file.WriteString(strconv.Itoa(io.params.ImageWidth))
+	_, _ = file.WriteString(strconv.Itoa(width))
 	_, _ = file.WriteString(" ")
-	_, _ = file.WriteString(strconv.Itoa(io.params.ImageHeight))
+	_, _ = file.WriteString(strconv.Itoa(height))
 	_, _ = file.WriteString("\n")
 	_, _ = file.WriteString(strconv.Itoa(255))
 	_, _ = file.WriteString("\n")
 
-	world := make([][]byte, io.params.ImageHeight)
+	world := make([][]byte, height)
 	for i := range world {
-		world[i] = make([]byte, io.params.ImageWidth)
+		world[i] = make([]byte, width)
 	}
 
-	for y := 0; y < io.params.ImageHeight; y++ {
-		for x := 0; x < io.params.ImageWidth; x++ {
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
 			val := <-io.channels.output
 			//if val != 0 {
 			//	fmt.Println(x, y)
 			//}
-			world[y][x] = val
+			world[y][x] = io.rule.grey(val)
 		}
 	}
 
-	for y := 0; y < io.params.ImageHeight; y++ {
-		for x := 0; x < io.params.ImageWidth; x++ {
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
 			_, ioError = file.Write([]byte{world[y][x]})
 			util.Check(ioError)
 		}
@@ -85,7 +88,7 @@ func (io *ioState) writePgmImage() {
 	fmt.Println("File", filename, "output done!")
 }
 
-// readPgmImage opens a pgm file and sends its data as an array of bytes.
+// readPgmImage opens a pgm file and sends its data as an array of cell states.
 func (io *ioState) readPgmImage() {
 
 	// Request a filename from the distributor.
@@ -94,9 +97,9 @@ func (io *ioState) readPgmImage() {
 	data, ioError := os.ReadFile("images/" + filename + ".pgm")
 	util.Check(ioError)
 
+	// Only split off the header, as the pixel data may contain whitespace bytes.
 	fields := strings.Fields(string(data))
-
-	if fields[0] != "P5" {
+	if len(fields) < 4 || fields[0] != "P5" {
 		panic("Not a pgm file")
 	}
 
@@ -115,19 +118,57 @@ func (io *ioState) readPgmImage() {
 		panic("Incorrect maxval/bit depth")
 	}
 
-	image := []byte(fields[4])
+	image := pgmPixels(data)
+	if len(image) < width*height {
+		panic("Not enough pixel data")
+	}
+
+	var states [256]int
+	for grey := range states {
+		state, ok := io.rule.stateOf(byte(grey))
+		states[grey] = int(state)
+		if !ok {
+			states[grey] = -1
+		}
+	}
 
-	for _, b := range image {
-		io.channels.input <- b
+	for _, b := range image[:width*height] {
+		if states[b] < 0 {
+			panic(fmt.Sprintf("Grey level %v is not a state of rule %v", b, io.rule))
+		}
+		io.channels.input <- byte(states[b])
 	}
 
 	fmt.Println("File", filename, "input done!")
 }
 
+// pgmPixels returns the pixel data following the four whitespace separated header fields of a binary pgm file.
+func pgmPixels(data []byte) []byte {
+	i := 0
+	for field := 0; field < 4; field++ {
+		for i < len(data) && isPgmSpace(data[i]) {
+			i++
+		}
+		for i < len(data) && !isPgmSpace(data[i]) {
+			i++
+		}
+	}
+	// Exactly one whitespace byte separates the header from the pixels.
+	if i >= len(data) {
+		return nil
+	}
+	return data[i+1:]
+}
+
+func isPgmSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\v' || b == '\f'
+}
+
 // startIo should be the entrypoint of the io goroutine.
-func startIo(p Params, c ioChannels) {
+func startIo(p Params, rule Rule, c ioChannels) {
 	io := ioState{
 		params:   p,
+		rule:     rule,
 		channels: c,
 	}
 
@@ -0,0 +1,179 @@
+package gol
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Isotropic non-totalistic rules use Hensel notation, where each neighbour count in a rulestring
+// can be followed by letters picking out configurations of that many neighbours, e.g. "B2a3/S12-e".
+// A '-' after the count means every configuration except the ones listed.
+//
+// Configurations are 9 bit indices of the 3x3 neighbourhood in row-major order,
+// with the top left neighbour as bit 0 and the cell itself as bit 4.
+
+// centreBit is the bit of a configuration index set when the cell itself is alive.
+const centreBit = 1 << 4
+
+// henselLetters lists the letters used for each neighbour count, in the same order as henselShapes.
+var henselLetters = [9]string{"", "ce", "ceaikn", "ceaiknjqry", "ceaiknjqrytwz", "ceaiknjqry", "ceaikn", "ce", ""}
+
+// henselShapes holds one configuration for each letter of counts 1 to 4.
+// Counts 5 to 8 use the complements of the configurations for 3 to 0.
+var henselShapes = [5][]int{
+	{},
+	{1, 2},
+	{5, 10, 3, 40, 33, 68},
+	{69, 42, 11, 7, 98, 13, 14, 70, 41, 97},
+	{325, 170, 15, 45, 99, 71, 106, 102, 43, 101, 105, 78, 108},
+}
+
+// henselLetter maps every configuration of neighbours (ignoring the centre bit) to its letter.
+var henselLetter = buildHenselLetters()
+
+// buildHenselLetters gives every configuration the letter of the shape it is a rotation or reflection of.
+func buildHenselLetters() [512]byte {
+	var letters [512]byte
+	const neighbourBits = 511 &^ centreBit
+
+	for count, shapeLetters := range henselLetters {
+		for i, letter := range []byte(shapeLetters) {
+			var shape int
+			if count <= 4 {
+				shape = henselShapes[count][i]
+			} else {
+				shape = neighbourBits &^ henselShapes[8-count][i]
+			}
+			for _, symmetric := range symmetries(shape) {
+				letters[symmetric] = letter
+			}
+		}
+	}
+	return letters
+}
+
+// symmetries returns the 8 rotations and reflections of a configuration.
+func symmetries(config int) []int {
+	transforms := []func(x, y int) (int, int){
+		func(x, y int) (int, int) { return x, y },
+		func(x, y int) (int, int) { return 2 - y, x },
+		func(x, y int) (int, int) { return 2 - x, 2 - y },
+		func(x, y int) (int, int) { return y, 2 - x },
+		func(x, y int) (int, int) { return 2 - x, y },
+		func(x, y int) (int, int) { return x, 2 - y },
+		func(x, y int) (int, int) { return y, x },
+		func(x, y int) (int, int) { return 2 - y, 2 - x },
+	}
+
+	var configs []int
+	for _, transform := range transforms {
+		symmetric := 0
+		for bit := 0; bit < 9; bit++ {
+			if config&(1<<bit) != 0 {
+				x, y := transform(bit%3, bit/3)
+				symmetric |= 1 << (y*3 + x)
+			}
+		}
+		configs = append(configs, symmetric)
+	}
+	return configs
+}
+
+// isHensel reports whether a birth or survival part of a rulestring uses Hensel letters.
+func isHensel(part string) bool {
+	return strings.ContainsAny(part, "-CEKAINYQJRTWZ")
+}
+
+// parseHensel sets configs[i] for every configuration of neighbours i (ignoring the centre bit) described by the
+// upper-cased birth or survival part of a rulestring, such as "2-A3".
+func parseHensel(part string, configs *[512]bool) error {
+	var count = -1
+	var letters string
+	var negated bool
+
+	apply := func() error {
+		if count < 0 {
+			return nil
+		}
+		valid := strings.ToUpper(henselLetters[count])
+		for _, letter := range letters {
+			if !strings.ContainsRune(valid, letter) {
+				return fmt.Errorf("%d%c is not a configuration of %d neighbours", count, letter+'a'-'A', count)
+			}
+		}
+		for config := range configs {
+			if config&centreBit != 0 || popCount(config) != count {
+				continue
+			}
+			listed := strings.ContainsRune(letters, rune(henselLetter[config]+'A'-'a'))
+			if letters == "" || listed != negated {
+				configs[config] = true
+			}
+		}
+		return nil
+	}
+
+	for _, c := range part {
+		switch {
+		case c >= '0' && c <= '8':
+			if err := apply(); err != nil {
+				return err
+			}
+			count, letters, negated = int(c-'0'), "", false
+		case c == '-' && count >= 0 && letters == "" && !negated:
+			negated = true
+		case c >= 'A' && c <= 'Z' && count >= 0:
+			if strings.ContainsRune(letters, c) {
+				return fmt.Errorf("%d%c is repeated", count, c+'a'-'A')
+			}
+			letters += string(c)
+		default:
+			return fmt.Errorf("unexpected %q", c)
+		}
+	}
+	return apply()
+}
+
+// parseIsotropic builds the transition table of an isotropic non-totalistic rule from its birth and survival parts.
+// transitions[config] is true if the cell is alive next turn.
+func parseIsotropic(birth, survival string) (*[512]bool, error) {
+	var born, survives [512]bool
+	if err := parseHensel(birth, &born); err != nil {
+		return nil, fmt.Errorf("birth %v", err)
+	}
+	if err := parseHensel(survival, &survives); err != nil {
+		return nil, fmt.Errorf("survival %v", err)
+	}
+
+	var transitions [512]bool
+	for config := range transitions {
+		if config&centreBit != 0 {
+			transitions[config] = survives[config&^centreBit]
+		} else {
+			transitions[config] = born[config]
+		}
+	}
+	return &transitions, nil
+}
+
+// neighbourhoodIndex returns the configuration index of the 3x3 neighbourhood around (x, y),
+// with a bit set for every alive cell.
+func neighbourhoodIndex(p Params, topology Topology, world [][]byte, x, y int) int {
+	index := 0
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			if topology.cell(p, world, x+dx, y+dy) == alive {
+				index |= 1 << ((dy+1)*3 + dx + 1)
+			}
+		}
+	}
+	return index
+}
+
+func popCount(config int) int {
+	count := 0
+	for ; config != 0; config &= config - 1 {
+		count++
+	}
+	return count
+}
@@ -0,0 +1,40 @@
+package gol
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestHenselShapes tests that the rotations and reflections of the shapes of each letter of 1 to 4 neighbours cover
+// the 8, 28, 56 and 70 configurations of that many neighbours without overlapping, and that every configuration of 1
+// to 7 neighbours is given a letter used for its count.
+func TestHenselShapes(t *testing.T) {
+	expected := []int{1, 8, 28, 56, 70}
+	for count := 1; count <= 4; count++ {
+		letters := make(map[int]byte)
+		for i, shape := range henselShapes[count] {
+			if popCount(shape) != count || shape&centreBit != 0 {
+				t.Errorf("ERROR: shape %v of %d%c is not %d neighbours", shape, count, henselLetters[count][i], count)
+			}
+			for _, config := range symmetries(shape) {
+				if letter, ok := letters[config]; ok && letter != henselLetters[count][i] {
+					t.Errorf("ERROR: configuration %v is both %d%c and %d%c", config, count, letter, count, henselLetters[count][i])
+				}
+				letters[config] = henselLetters[count][i]
+			}
+		}
+		if len(letters) != expected[count] {
+			t.Errorf("ERROR: the shapes of %d neighbours give %v configurations, expected %v", count, len(letters), expected[count])
+		}
+	}
+
+	for config, letter := range henselLetter {
+		count := popCount(config)
+		if config&centreBit != 0 || count == 0 || count == 8 {
+			continue
+		}
+		if strings.IndexByte(henselLetters[count], letter) < 0 {
+			t.Errorf("ERROR: configuration %v of %d neighbours has letter %q", config, count, letter)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package gol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxRange is the largest neighbourhood radius accepted for Larger than Life rules.
+const maxRange = 10
+
+// parseLargerThanLife parses a rule in Golly's Larger than Life notation, e.g. "R5,C0,M1,S34..58,B34..45,NM".
+// s is the upper-cased rulestring, rulestring is the original used in error messages.
+func parseLargerThanLife(rulestring, s string) (Rule, error) {
+	rule := Rule{States: 2, Neighbourhood: Moore}
+	var survival, birth string
+
+	for _, part := range strings.Split(s, ",") {
+		if part == "" {
+			return rule, fmt.Errorf("invalid rule %q: empty part", rulestring)
+		}
+		value := part[1:]
+		var err error
+		switch part[0] {
+		case 'R':
+			rule.Range, err = strconv.Atoi(value)
+			if err == nil && (rule.Range < 1 || rule.Range > maxRange) {
+				err = fmt.Errorf("range must be from 1 to %d", maxRange)
+			}
+		case 'C':
+			rule.States, err = strconv.Atoi(value)
+			if err == nil && (rule.States < 0 || rule.States > 256) {
+				err = fmt.Errorf("state count must be from 0 to 256")
+			}
+			if rule.States < 2 {
+				rule.States = 2 //C0 and C1 are the same as C2
+			}
+		case 'M':
+			if value != "0" && value != "1" {
+				err = fmt.Errorf("middle must be 0 or 1")
+			}
+			rule.Middle = value == "1"
+		case 'S':
+			survival = value
+		case 'B':
+			birth = value
+		case 'N':
+			switch value {
+			case "M":
+				rule.Neighbourhood = Moore
+			case "N":
+				rule.Neighbourhood = VonNeumann
+			case "C":
+				rule.Neighbourhood = Circular
+			default:
+				err = fmt.Errorf("neighbourhood must be NM, NN or NC")
+			}
+		default:
+			err = fmt.Errorf("unknown part %q", part)
+		}
+		if err != nil {
+			return rule, fmt.Errorf("invalid rule %q: %v", rulestring, err)
+		}
+	}
+	if rule.Range == 0 {
+		return rule, fmt.Errorf("invalid rule %q: missing range R", rulestring)
+	}
+
+	maxCount := neighbourhoodSize(rule)
+	if rule.Middle {
+		maxCount++
+	}
+	rule.Birth = make([]bool, maxCount+1)
+	rule.Survival = make([]bool, maxCount+1)
+	if err := parseCountRange(birth, rule.Birth); err != nil {
+		return rule, fmt.Errorf("invalid rule %q: birth %v", rulestring, err)
+	}
+	if err := parseCountRange(survival, rule.Survival); err != nil {
+		return rule, fmt.Errorf("invalid rule %q: survival %v", rulestring, err)
+	}
+	return rule, nil
+}
+
+// parseCountRange sets counts[n] for every n in a range written as "min..max" or a single count.
+// An empty range leaves counts unset.
+func parseCountRange(s string, counts []bool) error {
+	if s == "" {
+		return nil
+	}
+	bounds := strings.SplitN(s, "..", 2)
+	min, err := strconv.Atoi(bounds[0])
+	if err != nil {
+		return fmt.Errorf("range %q is not a number", s)
+	}
+	max := min
+	if len(bounds) == 2 {
+		max, err = strconv.Atoi(bounds[1])
+		if err != nil {
+			return fmt.Errorf("range %q is not a number", s)
+		}
+	}
+	if min < 0 || min > max || max >= len(counts) {
+		return fmt.Errorf("range %q must be within 0..%d", s, len(counts)-1)
+	}
+	for n := min; n <= max; n++ {
+		counts[n] = true
+	}
+	return nil
+}
+
+// largerThanLifeString returns the rule in Golly's Larger than Life notation.
+func largerThanLifeString(rule Rule) string {
+	middle := 0
+	if rule.Middle {
+		middle = 1
+	}
+	states := rule.States
+	if states == 2 {
+		states = 0
+	}
+	return fmt.Sprintf("R%d,C%d,M%d,S%s,B%s,N%c",
+		rule.Range, states, middle, countRangeString(rule.Survival), countRangeString(rule.Birth), "MNC"[rule.Neighbourhood])
+}
+
+// countRangeString returns the counts set in a Larger than Life rule as "min..max".
+func countRangeString(counts []bool) string {
+	min, max := -1, -1
+	for n, set := range counts {
+		if set {
+			if min < 0 {
+				min = n
+			}
+			max = n
+		}
+	}
+	if min < 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d..%d", min, max)
+}
+
+// halfWidth returns how far the neighbourhood reaches left and right on the row dy away from the cell.
+func halfWidth(rule Rule, dy int) int {
+	r := rule.Range
+	if dy < 0 {
+		dy = -dy
+	}
+	switch rule.Neighbourhood {
+	case VonNeumann:
+		return r - dy
+	case Circular:
+		w := 0
+		for (w+1)*(w+1)+dy*dy <= r*r+r {
+			w++
+		}
+		return w
+	default:
+		return r
+	}
+}
+
+// neighbourhoodSize returns the number of neighbours of a cell, not counting the cell itself.
+func neighbourhoodSize(rule Rule) int {
+	size := 0
+	for dy := -rule.Range; dy <= rule.Range; dy++ {
+		size += 2*halfWidth(rule, dy) + 1
+	}
+	return size - 1
+}
+
+// rangeNeighbours counts the alive neighbours of every cell in columns startX up to endX of rows startY up to endY
+// for a Larger than Life rule, so counts[y-startY][x-startX] is the count of the cell at (x, y).
+// Rather than summing the neighbourhood of each cell, it builds prefix sums over the rows of the area
+// (padded past the edges of the world by its topology) so each cell costs one lookup per neighbourhood row, or a single
+// summed-area table lookup for Moore neighbourhoods.
+func rangeNeighbours(p Params, rule Rule, world [][]byte, startX, endX, startY, endY int) [][]int {
+	r := rule.Range
+	height := endY - startY + 2*r
+	width := endX - startX + 2*r
+
+	//prefix[i][k] is the number of alive cells in the first k columns of padded row i
+	prefix := make([][]int32, height)
+	for i := range prefix {
+		prefix[i] = make([]int32, width+1)
+		for k := 0; k < width; k++ {
+			prefix[i][k+1] = prefix[i][k]
+			if rule.topology.cell(p, world, startX+k-r, startY-r+i) == alive {
+				prefix[i][k+1]++
+			}
+		}
+	}
+
+	//area[i][k] is the number of alive cells in the first i rows and k columns
+	var area [][]int32
+	if rule.Neighbourhood == Moore {
+		area = make([][]int32, height+1)
+		area[0] = make([]int32, width+1)
+		for i := 0; i < height; i++ {
+			area[i+1] = make([]int32, width+1)
+			for k := range area[i+1] {
+				area[i+1][k] = area[i][k] + prefix[i][k]
+			}
+		}
+	}
+
+	widths := make([]int, 2*r+1)
+	for dy := -r; dy <= r; dy++ {
+		widths[dy+r] = halfWidth(rule, dy)
+	}
+
+	counts := make([][]int, endY-startY)
+	for y := range counts {
+		counts[y] = make([]int, endX-startX)
+		for x := range counts[y] {
+			var sum int32
+			if area != nil {
+				sum = area[y+2*r+1][x+2*r+1] - area[y][x+2*r+1] - area[y+2*r+1][x] + area[y][x]
+			} else {
+				for i, w := range widths {
+					sum += prefix[y+i][x+r+w+1] - prefix[y+i][x+r-w]
+				}
+			}
+			if world[startY+y][startX+x] == alive {
+				sum-- //The cell itself is not one of its neighbours
+			}
+			counts[y][x] = int(sum)
+		}
+	}
+	return counts
+}
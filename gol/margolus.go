@@ -0,0 +1,73 @@
+package gol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Margolus rules split the world into 2x2 blocks and replace each block using a 16 entry table.
+// Blocks start at even coordinates on even turns and at odd coordinates on odd turns, wrapping around the torus.
+//
+// A block is numbered by adding 1 for its top left cell, 2 for top right, 4 for bottom left
+// and 8 for bottom right, as in MCell's "MS,D..." notation.
+
+// margolusPresets are well known Margolus rules that can be given by name.
+var margolusPresets = map[string]string{
+	"CRITTERS": "MS,D15;14;13;3;11;5;6;1;7;9;10;2;12;4;8;0",
+	"TRON":     "MS,D15;1;2;3;4;5;6;7;8;9;10;11;12;13;14;0",
+	"BBM":      "MS,D0;8;4;3;2;5;9;7;1;6;10;11;12;13;14;15", //Billiard ball machine
+}
+
+// isMargolus reports whether an upper-cased rulestring is a Margolus rule or the name of a preset.
+func isMargolus(s string) bool {
+	_, preset := margolusPresets[s]
+	return preset || strings.HasPrefix(s, "MS,D")
+}
+
+// parseMargolus parses a Margolus rule such as "MS,D0;8;4;3;2;5;9;7;1;6;10;11;12;13;14;15" or a preset name.
+func parseMargolus(rulestring, s string) (Rule, error) {
+	rule := Rule{States: 2, Range: 1, name: s}
+	if preset, ok := margolusPresets[s]; ok {
+		s = preset
+		rule.name = strings.TrimSpace(rulestring)
+	}
+
+	entries := strings.Split(strings.TrimPrefix(s, "MS,D"), ";")
+	if len(entries) != 16 {
+		return rule, fmt.Errorf("invalid rule %q: Margolus rules need 16 block entries", rulestring)
+	}
+	var blocks [16]byte
+	for i, entry := range entries {
+		block, err := strconv.Atoi(entry)
+		if err != nil || block < 0 || block > 15 {
+			return rule, fmt.Errorf("invalid rule %q: block entry %q must be from 0 to 15", rulestring, entry)
+		}
+		blocks[i] = byte(block)
+	}
+	rule.margolus = &blocks
+	return rule, nil
+}
+
+// margolusNext returns the state of the cell at (x, y) after the given turn.
+// Each cell works out its own block, so any rows can be computed without the rest of their blocks.
+func margolusNext(p Params, blocks *[16]byte, world [][]byte, turn, x, y int) byte {
+	offset := turn % 2
+	left := x - (x-offset+2)%2 //The block's top left corner
+	top := y - (y-offset+2)%2
+
+	block := 0
+	for i := 0; i < 4; i++ {
+		bx := (left + i%2 + p.ImageWidth) % p.ImageWidth
+		by := (top + i/2 + p.ImageHeight) % p.ImageHeight
+		if world[by][bx] == alive {
+			block |= 1 << i
+		}
+	}
+
+	bit := (x-left)%2 + 2*((y-top)%2)
+	if blocks[block]&(1<<bit) != 0 {
+		return alive
+	}
+	return dead
+}
@@ -0,0 +1,75 @@
+package gol
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Neighbourhood is the shape of the cells counted as neighbours.
+type Neighbourhood int
+
+const (
+	Moore      Neighbourhood = iota // All cells within Range in both directions
+	VonNeumann                      // Cells within a Manhattan distance of Range
+	Circular                        // Cells within a Euclidean distance of Range + 1/2
+	Hexagonal                       // The 6 cells around a hexagon, with odd rows offset half a cell to the right
+)
+
+// offset is the position of a neighbour relative to a cell.
+type offset struct {
+	dx, dy int
+}
+
+var (
+	mooreOffsets      = []offset{{-1, -1}, {0, -1}, {1, -1}, {-1, 0}, {1, 0}, {-1, 1}, {0, 1}, {1, 1}}
+	vonNeumannOffsets = []offset{{0, -1}, {-1, 0}, {1, 0}, {0, 1}}
+
+	// In the offset-row layout even rows touch the cells above and below on their left,
+	// and odd rows (which are shifted right by half a cell) touch the cells on their right.
+	hexEvenOffsets = []offset{{-1, -1}, {0, -1}, {-1, 0}, {1, 0}, {-1, 1}, {0, 1}}
+	hexOddOffsets  = []offset{{0, -1}, {1, -1}, {-1, 0}, {1, 0}, {0, 1}, {1, 1}}
+)
+
+// ParseNeighbourhood parses a neighbourhood name: "moore", "vonneumann" or "hex".
+func ParseNeighbourhood(name string) (Neighbourhood, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "moore", "m":
+		return Moore, nil
+	case "vonneumann", "von-neumann", "v":
+		return VonNeumann, nil
+	case "hex", "hexagonal", "h":
+		return Hexagonal, nil
+	default:
+		return Moore, fmt.Errorf("invalid neighbourhood %q: expected moore, vonneumann or hex", name)
+	}
+}
+
+// offsets returns the range 1 neighbours of a cell in row y.
+func (neighbourhood Neighbourhood) offsets(y int) []offset {
+	switch neighbourhood {
+	case VonNeumann:
+		return vonNeumannOffsets
+	case Hexagonal:
+		if y%2 == 0 {
+			return hexEvenOffsets
+		}
+		return hexOddOffsets
+	default:
+		return mooreOffsets
+	}
+}
+
+func (neighbourhood Neighbourhood) String() string {
+	switch neighbourhood {
+	case Moore:
+		return "moore"
+	case VonNeumann:
+		return "vonneumann"
+	case Circular:
+		return "circular"
+	case Hexagonal:
+		return "hex"
+	default:
+		return "Incorrect Neighbourhood"
+	}
+}
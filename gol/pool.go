@@ -0,0 +1,206 @@
+package gol
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// parallelStrategy computes the dense engine's turns between p.Threads workers.
+type parallelStrategy interface {
+	// step returns the world after one turn, and the cells that changed with their new states. If events is not nil,
+	// each worker sends the cells it changed to events itself before the turn ends, and none are returned.
+	// The world it is given may be written over on a later turn.
+	step(rule Rule, world [][]byte, turn int, events chan<- Event) ([][]byte, []util.Cell, []byte)
+	// stats returns how busy each worker has been since the last call, or since the workers started.
+	stats() []WorkerStat
+	// stop ends the workers.
+	stop()
+}
+
+// newParallelStrategy starts the workers of the strategy selected by p, shared memory unless it is halo exchange.
+func newParallelStrategy(p Params, schedule []scheduledRule, world [][]byte) parallelStrategy {
+	if isHalo(p) {
+		return newHaloPool(p, schedule, world)
+	}
+	return newWorkerPool(p, schedule)
+}
+
+// workerPool is the shared-memory strategy. It runs the dense engine's turns on long-lived workers, which are
+// started with the dense engine and wait at a barrier at the end of each turn. Each turn only the tiles that
+// can change are worked out, so the work shrinks as the board settles. The tiles are put on a work queue that
+// every worker takes them from one at a time until it is empty, so a worker given quick tiles simply takes more
+// and no thread count leaves a worker idle while others have a backlog. With the stealing strategy each worker
+// has its own queue instead, and takes from the others once it runs out. Each worker finds the cells of its
+// tiles that changed and sends them to the GUI itself, so no pass over the whole world is left once the turn
+// is done. The workers write into a second world that is swapped with the current one after the turn, which
+// still holds the cells of tiles that could not change, so no world is allocated once the pool exists.
+type workerPool struct {
+	p       Params
+	jobs    []chan poolJob
+	barrier sync.WaitGroup
+	next    [][]byte
+	tiles   *activeTiles
+	changes [][]util.Cell // The cells each worker changed on the last turn
+	states  [][]byte      // The states the cells in changes changed to
+	busy    []WorkerStat  // How busy each worker has been since the stats were last taken, at since
+	since   time.Time
+}
+
+// poolJob is one turn for a worker: the world to read, the world to write, the rule to run, the queue of tiles
+// to work out and where to send the cells that changed, if anywhere.
+type poolJob struct {
+	rule        Rule
+	world, next [][]byte
+	turn        int
+	queue       tileQueue
+	events      chan<- Event
+}
+
+// tileQueue hands out the tiles of a turn to the workers.
+type tileQueue interface {
+	// take returns the next tile for worker i to work out and whether the worker had to steal it from another
+	// worker's share, or false once there are no tiles left.
+	take(i int) (tile int, stole, ok bool)
+}
+
+// workQueue holds the tiles of a turn. Workers take the tile at taken and move it on in one atomic step,
+// so no two workers take the same tile and none wait for each other to take one.
+type workQueue struct {
+	taken int64 // First, so it is aligned for atomic operations on 32-bit platforms
+	tiles []int
+}
+
+// take returns the next tile to work out, or false once every tile has been taken.
+// Workers share the queue, so none ever steals.
+func (q *workQueue) take(_ int) (int, bool, bool) {
+	i := atomic.AddInt64(&q.taken, 1) - 1
+	if i >= int64(len(q.tiles)) {
+		return 0, false, false
+	}
+	return q.tiles[i], false, true
+}
+
+// newWorkerPool starts p.Threads workers.
+func newWorkerPool(p Params, schedule []scheduledRule) *workerPool {
+	threads := p.Threads
+	if threads < 1 {
+		threads = 1
+	}
+
+	pool := &workerPool{
+		p:       p,
+		jobs:    make([]chan poolJob, threads),
+		next:    make([][]byte, p.ImageHeight),
+		tiles:   newActiveTiles(p, schedule),
+		changes: make([][]util.Cell, threads),
+		states:  make([][]byte, threads),
+		busy:    make([]WorkerStat, threads),
+		since:   time.Now(),
+	}
+	for y := range pool.next {
+		pool.next[y] = make([]byte, p.ImageWidth)
+	}
+	for i := range pool.jobs {
+		pool.jobs[i] = make(chan poolJob)
+		go pool.worker(i, pool.jobs[i])
+	}
+	return pool
+}
+
+// worker computes tiles from the queue of each turn it is sent, and sends the cells of its tiles that changed,
+// until the pool is stopped. Worker i keeps the cells in pool.changes[i] for the pool to find the next active
+// tiles, and adds the time it spent on the tiles to pool.busy[i].
+func (pool *workerPool) worker(i int, jobs <-chan poolJob) {
+	for job := range jobs {
+		start := time.Now()
+		var cells []util.Cell
+		var states []byte
+		for tile, stole, ok := job.queue.take(i); ok; tile, stole, ok = job.queue.take(i) {
+			if stole {
+				pool.busy[i].Steals++
+			}
+			startX, endX, startY, endY := pool.tiles.bounds(pool.p, tile)
+			nextArea(pool.p, job.rule, job.world, job.turn, startX, endX, startY, endY, job.next[startY:endY])
+			cells, states = appendChanges(job.world, job.next, startX, endX, startY, endY, cells, states)
+		}
+		pool.busy[i].Busy += time.Since(start)
+		if job.events != nil {
+			sendFlipped(job.events, job.rule, job.turn, cells, states)
+		}
+		pool.changes[i], pool.states[i] = cells, states
+		pool.barrier.Done()
+	}
+}
+
+// step returns the world after one turn, which becomes the current world, and keeps the world it was given to
+// write the next turn into. The cells the workers changed make the tiles around them active on the next turn.
+func (pool *workerPool) step(rule Rule, world [][]byte, turn int, events chan<- Event) ([][]byte, []util.Cell, []byte) {
+	tiles := pool.tiles.active(rule, turn)
+	var queue tileQueue = &workQueue{tiles: tiles}
+	if isStealing(pool.p) {
+		queue = newStealQueue(tiles, len(pool.jobs))
+	}
+	pool.barrier.Add(len(pool.jobs))
+	for _, jobs := range pool.jobs {
+		jobs <- poolJob{rule, world, pool.next, turn, queue, events}
+	}
+	pool.barrier.Wait()
+	var cells []util.Cell
+	var states []byte
+	for i := range pool.changes {
+		pool.tiles.change(pool.changes[i])
+		if events == nil {
+			cells = append(cells, pool.changes[i]...)
+			states = append(states, pool.states[i]...)
+		}
+		pool.changes[i], pool.states[i] = nil, nil
+	}
+
+	next := pool.next
+	pool.next = world
+	return next, cells, states
+}
+
+// stats returns how busy each worker has been since the last call.
+func (pool *workerPool) stats() []WorkerStat {
+	stats := workerStats(pool.busy, time.Since(pool.since))
+	pool.since = time.Now()
+	return stats
+}
+
+// stop ends the workers.
+func (pool *workerPool) stop() {
+	for _, jobs := range pool.jobs {
+		close(jobs)
+	}
+}
+
+// appendChanges appends the cells of columns startX up to endX of rows startY up to endY that differ between world
+// and next to cells, and their states in next to states.
+func appendChanges(world, next [][]byte, startX, endX, startY, endY int, cells []util.Cell, states []byte) ([]util.Cell, []byte) {
+	for y := startY; y < endY; y++ {
+		for x := startX; x < endX; x++ {
+			if world[y][x] != next[y][x] {
+				cells = append(cells, util.Cell{X: x, Y: y})
+				states = append(states, next[y][x])
+			}
+		}
+	}
+	return cells, states
+}
+
+// workerStats returns the workers' busy times and steals as a share of the time elapsed, and clears them.
+func workerStats(busy []WorkerStat, elapsed time.Duration) []WorkerStat {
+	stats := make([]WorkerStat, len(busy))
+	for i := range busy {
+		stats[i] = busy[i]
+		if elapsed > 0 {
+			stats[i].Utilisation = float64(busy[i].Busy) / float64(elapsed)
+		}
+		busy[i] = WorkerStat{}
+	}
+	return stats
+}
@@ -0,0 +1,32 @@
+package gol
+
+// rowRandom is the stream of random numbers used by probabilistic rules for one row of one turn.
+// It is derived only from the seed, turn and row, so a row gets the same numbers whichever worker computes it.
+//
+// The stream is splitmix64, whose n'th output is a hash of state + n*gamma, so the number for any cell
+// can be found directly without generating the numbers for the cells before it.
+type rowRandom struct {
+	state uint64
+}
+
+const splitMixGamma = 0x9E3779B97F4A7C15
+
+// newRowRandom returns the random stream for row y of the given turn.
+func newRowRandom(seed int64, turn, y int) rowRandom {
+	state := splitMix(uint64(seed))
+	state = splitMix(state ^ uint64(turn))
+	state = splitMix(state ^ uint64(y))
+	return rowRandom{state}
+}
+
+// at returns the random number in [0, 1) for the cell in column x.
+func (r rowRandom) at(x int) float64 {
+	return float64(splitMix(r.state+uint64(x+1)*splitMixGamma)>>11) / (1 << 53)
+}
+
+// splitMix is the splitmix64 output function.
+func splitMix(z uint64) uint64 {
+	z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+	return z ^ (z >> 31)
+}
@@ -0,0 +1,177 @@
+package gol
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Region gives the rule followed by every cell of one grey level in a mask image.
+type Region struct {
+	Grey uint8  // Grey level of the region in the mask
+	Rule string // Rulestring followed by the region, in any notation accepted by ParseRule
+	Tint uint32 // 0xRRGGBB colour the GUI draws the region's dead cells with, or 0 for black
+}
+
+// LoadPalette reads the regions of a mask from a text file with one region per line,
+// giving its grey level, its rulestring and optionally a tint, e.g.
+//
+//	# A Life island in a sea of Seeds
+//	255 B3/S23 0x203060
+//	0   B2/S
+//
+// Blank lines and anything after a '#' are ignored.
+func LoadPalette(path string) ([]Region, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var palette []Region
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 3 || len(fields) < 2 {
+			return nil, fmt.Errorf("%v: line %d: expected a grey level, a rulestring and an optional tint", path, lineNumber)
+		}
+		grey, err := strconv.ParseUint(fields[0], 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("%v: line %d: %q is not a grey level from 0 to 255", path, lineNumber, fields[0])
+		}
+		region := Region{Grey: uint8(grey), Rule: fields[1]}
+		if len(fields) == 3 {
+			tint, err := strconv.ParseUint(strings.TrimPrefix(fields[2], "0x"), 16, 24)
+			if err != nil || !strings.HasPrefix(fields[2], "0x") {
+				return nil, fmt.Errorf("%v: line %d: tint %q is not a colour like 0x203060", path, lineNumber, fields[2])
+			}
+			region.Tint = uint32(tint)
+		}
+		palette = append(palette, region)
+	}
+	return palette, scanner.Err()
+}
+
+// regionMap holds the rule of every cell when different regions of the world follow different rules.
+// The rule of the cell at (x, y) is rules[cells[y][x]].
+type regionMap struct {
+	cells [][]int // Index in rules of the region of each cell, which stays fixed for the whole run
+	rules []Rule  // The rule given by Params.Rule for grey levels not in the palette, then the palette's rules
+	greys []uint8 // Grey level of each of rules after the first
+}
+
+// newRegionRule returns the rule of a world split into regions by p.Mask.
+// Cells whose grey level is in p.Palette follow that region's rule and the rest follow p.Rule.
+// Every rule uses p.Neighbourhood and the miss probabilities of p, and must have the same number of states.
+func newRegionRule(p Params) (Rule, error) {
+	if p.RuleFile != "" || len(p.Schedule) > 0 {
+		return Rule{}, fmt.Errorf("rule files and rule schedules cannot be used with a mask")
+	}
+
+	baseParams := p
+	baseParams.Mask, baseParams.Palette = "", nil
+	base, err := newRule(baseParams)
+	if err != nil {
+		return base, err
+	}
+
+	regions := regionMap{rules: []Rule{base}}
+	var seen [256]bool
+	for _, region := range p.Palette {
+		if seen[region.Grey] {
+			return base, fmt.Errorf("grey level %d is in the palette more than once", region.Grey)
+		}
+		seen[region.Grey] = true
+
+		regionParams := baseParams
+		regionParams.Rule = region.Rule
+		rule, err := newRule(regionParams)
+		if err != nil {
+			return base, fmt.Errorf("region %d: %v", region.Grey, err)
+		}
+		if rule.States != base.States {
+			return base, fmt.Errorf("region %d: rule %v has %d states, but %v has %d", region.Grey, rule, rule.States, base, base.States)
+		}
+		regions.rules = append(regions.rules, rule)
+		regions.greys = append(regions.greys, region.Grey)
+	}
+
+	regions.cells, err = LoadMask(p)
+	if err != nil {
+		return base, err
+	}
+	for _, row := range regions.cells {
+		for x := range row {
+			row[x]++ //The base rule comes before the palette's rules
+		}
+	}
+	base.regions = &regions
+	return base, nil
+}
+
+// LoadMask reads the mask image p.Mask and returns, for every cell, the index in p.Palette of its region,
+// or -1 if its grey level is not in the palette and it follows p.Rule.
+func LoadMask(p Params) ([][]int, error) {
+	if len(p.Palette) == 0 {
+		return nil, fmt.Errorf("mask %v needs a palette of regions", p.Mask)
+	}
+
+	data, err := os.ReadFile(p.Mask)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 4 || fields[0] != "P5" || fields[3] != "255" {
+		return nil, fmt.Errorf("mask %v is not an 8 bit binary pgm file", p.Mask)
+	}
+	if fields[1] != strconv.Itoa(p.ImageWidth) || fields[2] != strconv.Itoa(p.ImageHeight) {
+		return nil, fmt.Errorf("mask %v is %vx%v, but the image is %dx%d", p.Mask, fields[1], fields[2], p.ImageWidth, p.ImageHeight)
+	}
+	pixels := pgmPixels(data)
+	if len(pixels) < p.ImageWidth*p.ImageHeight {
+		return nil, fmt.Errorf("mask %v does not have enough pixel data", p.Mask)
+	}
+
+	var region [256]int
+	for grey := range region {
+		region[grey] = -1
+	}
+	for i, r := range p.Palette {
+		region[r.Grey] = i
+	}
+
+	mask := make([][]int, p.ImageHeight)
+	for y := range mask {
+		mask[y] = make([]int, p.ImageWidth)
+		for x := range mask[y] {
+			mask[y][x] = region[pixels[y*p.ImageWidth+x]]
+		}
+	}
+	return mask, nil
+}
+
+// regionsString returns the base rule followed by the rule of each region, e.g. "B2/S with B3/S23 on 255".
+func regionsString(regions *regionMap) string {
+	var b strings.Builder
+	b.WriteString(regions.rules[0].String())
+	for i, rule := range regions.rules[1:] {
+		if i == 0 {
+			b.WriteString(" with ")
+		} else {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%v on %d", rule, regions.greys[i])
+	}
+	return b.String()
+}
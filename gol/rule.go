@@ -0,0 +1,330 @@
+package gol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultRule is the rulestring used when Params.Rule is left empty (Conway's Game of Life).
+const DefaultRule = "B3/S23"
+
+// Cell states stored in the world. Generations rules add decaying states 2 to States-1.
+const (
+	dead  byte = 0
+	alive byte = 1
+)
+
+// Rule is a parsed outer-totalistic Life-like, Generations or Larger than Life rule.
+// Birth[n] is true if a dead cell with n alive neighbours becomes alive,
+// Survival[n] is true if an alive cell with n alive neighbours stays alive.
+// States is 2 for Life-like rules. For Generations rules an alive cell that does not
+// survive passes through the decaying states 2 to States-1 before it is dead again.
+// Range is 1 for Life-like rules, and Middle is true if a cell counts itself as a neighbour.
+// Life-like rules may use a Moore, VonNeumann or Hexagonal neighbourhood.
+// Birth and Survival are nil for isotropic non-totalistic rules, which look up
+// the next state of every 3x3 configuration in a table instead.
+// BirthMiss and SurvivalMiss make the rule probabilistic: they are the chances that a birth or
+// survival the rule calls for does not happen.
+type Rule struct {
+	Birth         []bool
+	Survival      []bool
+	States        int
+	Range         int
+	Neighbourhood Neighbourhood
+	Middle        bool
+	BirthMiss     float64
+	SurvivalMiss  float64
+
+	transitions *[512]bool   // Isotropic non-totalistic transition table, indexed as in neighbourhoodIndex
+	hensel      string       // Isotropic non-totalistic rulestring, used by String
+	table       *ruleTable   // Golly rule table loaded with LoadRuleFile
+	margolus    *[16]byte    // Margolus block table, see margolus.go
+	name        string       // Name of a Margolus rule, used by String
+	regions     *regionMap   // Rules of the regions of a mask, see region.go
+	topology    Topology     // Edges of the world the rule runs on, set from Params.Topology
+	lookup      *lookupTable // Next states of every 3x3 neighbourhood, set if Params.Lookup selects the lookup evaluator
+}
+
+// ParseRule parses a rulestring in either B/S notation (e.g. "B36/S23") or
+// S/B notation (e.g. "23/36"). Generations rules add a state count as a third part,
+// either "B2/S/C3" or "/2/3". A trailing H or V selects a hexagonal or von Neumann
+// neighbourhood, e.g. "B2/S34H". Isotropic non-totalistic rules use Hensel notation,
+// e.g. "B2-a3/S12". Larger than Life rules use Golly's notation,
+// e.g. "R5,C0,M1,S34..58,B34..45,NM". Margolus block rules use MCell's notation,
+// e.g. "MS,D0;8;4;3;2;5;9;7;1;6;10;11;12;13;14;15", or one of the names Critters, Tron and BBM.
+// An empty string gives the DefaultRule.
+func ParseRule(rulestring string) (Rule, error) {
+	rule := Rule{
+		Birth:    make([]bool, 9),
+		Survival: make([]bool, 9),
+		States:   2,
+		Range:    1,
+	}
+	s := strings.ToUpper(strings.TrimSpace(rulestring))
+	if s == "" {
+		s = DefaultRule
+	}
+	if isMargolus(s) {
+		return parseMargolus(rulestring, s)
+	}
+	if strings.HasPrefix(s, "R") && strings.Contains(s, ",") {
+		return parseLargerThanLife(rulestring, s)
+	}
+
+	switch {
+	case strings.HasSuffix(s, "H"):
+		rule.Neighbourhood = Hexagonal
+		s = strings.TrimSuffix(s, "H")
+	case strings.HasSuffix(s, "V"):
+		rule.Neighbourhood = VonNeumann
+		s = strings.TrimSuffix(s, "V")
+	}
+
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 && len(parts) != 3 {
+		return rule, fmt.Errorf("invalid rule %q: expected two or three parts separated by '/'", rulestring)
+	}
+
+	if len(parts) == 3 {
+		states, err := strconv.Atoi(strings.TrimPrefix(parts[2], "C"))
+		if err != nil || states < 2 || states > 256 {
+			return rule, fmt.Errorf("invalid rule %q: state count must be a number from 2 to 256", rulestring)
+		}
+		rule.States = states
+	}
+
+	var birth, survival string
+	switch {
+	case strings.HasPrefix(parts[0], "B") && strings.HasPrefix(parts[1], "S"):
+		birth, survival = parts[0][1:], parts[1][1:]
+	case strings.HasPrefix(parts[0], "S") && strings.HasPrefix(parts[1], "B"):
+		survival, birth = parts[0][1:], parts[1][1:]
+	case !strings.ContainsAny(parts[0]+parts[1], "BS"):
+		survival, birth = parts[0], parts[1] //Plain S/B notation, e.g. 23/3
+	default:
+		return rule, fmt.Errorf("invalid rule %q: expected B.../S... or S/B notation", rulestring)
+	}
+
+	if isHensel(birth) || isHensel(survival) {
+		if rule.Neighbourhood != Moore {
+			return rule, fmt.Errorf("invalid rule %q: isotropic non-totalistic rules need a Moore neighbourhood", rulestring)
+		}
+		transitions, err := parseIsotropic(birth, survival)
+		if err != nil {
+			return rule, fmt.Errorf("invalid rule %q: %v", rulestring, err)
+		}
+		rule.Birth, rule.Survival = nil, nil
+		rule.transitions = transitions
+		rule.hensel = "B" + strings.ToLower(birth) + "/S" + strings.ToLower(survival)
+		return rule, nil
+	}
+
+	size := len(rule.Neighbourhood.offsets(0))
+	if err := parseCounts(birth, rule.Birth, size); err != nil {
+		return rule, fmt.Errorf("invalid rule %q: birth %v", rulestring, err)
+	}
+	if err := parseCounts(survival, rule.Survival, size); err != nil {
+		return rule, fmt.Errorf("invalid rule %q: survival %v", rulestring, err)
+	}
+	return rule, nil
+}
+
+// NewRule returns the rule to run from turn 0: the rule table in p.RuleFile if it is set, otherwise p.Rule
+// parsed with ParseRule, using p.Neighbourhood if it is set, unless p.Schedule replaces it on turn 0.
+// It returns an error if any rule, including every rule in p.Schedule, is invalid or cannot be run
+// by p.Engine on a p.ImageWidth x p.ImageHeight world.
+func NewRule(p Params) (Rule, error) {
+	schedule, err := newRuleSchedule(p)
+	if err != nil {
+		return Rule{}, err
+	}
+	return schedule[0].rule, nil
+}
+
+// newRule returns the rule given by p, ignoring p.Schedule.
+func newRule(p Params) (Rule, error) {
+	if p.Mask != "" {
+		return newRegionRule(p)
+	}
+	if len(p.Palette) > 0 {
+		return Rule{}, fmt.Errorf("a palette of regions needs a mask")
+	}
+	if p.BirthMiss < 0 || p.BirthMiss > 1 || p.SurvivalMiss < 0 || p.SurvivalMiss > 1 {
+		return Rule{}, fmt.Errorf("birth and survival miss probabilities must be from 0 to 1")
+	}
+
+	topology, err := ParseTopology(p.Topology)
+	if err == nil {
+		err = topology.check(p)
+	}
+	if err != nil {
+		return Rule{}, err
+	}
+
+	if p.RuleFile != "" {
+		if p.Neighbourhood != "" {
+			return Rule{}, fmt.Errorf("rule files set their own neighbourhood, so they cannot be used with neighbourhood %v", p.Neighbourhood)
+		}
+		if p.BirthMiss != 0 || p.SurvivalMiss != 0 {
+			return Rule{}, fmt.Errorf("rule files have no births or survivals, so they cannot be probabilistic")
+		}
+		rule, err := LoadRuleFile(p.RuleFile)
+		rule.topology = topology
+		return rule, err
+	}
+
+	rule, err := ParseRule(p.Rule)
+	if err != nil {
+		return rule, err
+	}
+
+	if rule.margolus != nil {
+		if p.ImageWidth%2 != 0 || p.ImageHeight%2 != 0 {
+			return rule, fmt.Errorf("Margolus rules need an even image width and height, got %dx%d", p.ImageWidth, p.ImageHeight)
+		}
+		if p.Neighbourhood != "" || p.BirthMiss != 0 || p.SurvivalMiss != 0 {
+			return rule, fmt.Errorf("Margolus rules update whole blocks, so they cannot use a neighbourhood or be probabilistic")
+		}
+		if !topology.isTorus() {
+			return rule, fmt.Errorf("Margolus blocks wrap around the edges, so they cannot use topology %v", topology)
+		}
+		return rule, nil
+	}
+
+	if p.Neighbourhood != "" {
+		neighbourhood, err := ParseNeighbourhood(p.Neighbourhood)
+		if err != nil {
+			return rule, err
+		}
+		if rule.Range > 1 || rule.Middle || rule.Neighbourhood == Circular || rule.transitions != nil {
+			return rule, fmt.Errorf("rule %v sets its own neighbourhood, so it cannot be used with neighbourhood %v", rule, neighbourhood)
+		}
+		if neighbourhood != rule.Neighbourhood && rule.Neighbourhood != Moore {
+			return rule, fmt.Errorf("rule %v does not use neighbourhood %v", rule, neighbourhood)
+		}
+		for n := len(neighbourhood.offsets(0)) + 1; n < len(rule.Birth); n++ {
+			if rule.Birth[n] || rule.Survival[n] {
+				return rule, fmt.Errorf("rule %v uses %d neighbours, but neighbourhood %v only has %d", rule, n, neighbourhood, len(neighbourhood.offsets(0)))
+			}
+		}
+		rule.Neighbourhood = neighbourhood
+	}
+
+	if rule.Neighbourhood == Hexagonal && topology.edges == joined && p.ImageHeight%2 != 0 {
+		return rule, fmt.Errorf("hexagonal neighbourhoods need an even image height to wrap around, got %d", p.ImageHeight)
+	}
+	rule.BirthMiss, rule.SurvivalMiss = p.BirthMiss, p.SurvivalMiss
+	rule.topology = topology
+	return rule, nil
+}
+
+// parseCounts sets counts[n] for every digit n in digits, where n can be at most max.
+func parseCounts(digits string, counts []bool, max int) error {
+	for _, d := range digits {
+		if d < '0' || int(d-'0') > max {
+			return fmt.Errorf("neighbour count %q is not in the range 0-%d", d, max)
+		}
+		if counts[d-'0'] {
+			return fmt.Errorf("neighbour count %q is repeated", d)
+		}
+		counts[d-'0'] = true
+	}
+	return nil
+}
+
+// String returns the rule in B/S notation, B/S/C notation for Generations rules,
+// Golly's Larger than Life notation, or the name of a rule table.
+// Rules with regions list the rule of each region after the rule for the rest of the world.
+func (rule Rule) String() string {
+	if rule.regions != nil {
+		return regionsString(rule.regions)
+	}
+	if rule.table != nil {
+		return rule.table.name
+	}
+	if rule.margolus != nil {
+		return rule.name
+	}
+	if rule.Range > 1 || rule.Neighbourhood == Circular || rule.Middle {
+		return largerThanLifeString(rule)
+	}
+	if rule.transitions != nil {
+		if rule.States > 2 {
+			return fmt.Sprintf("%v/C%d", rule.hensel, rule.States)
+		}
+		return rule.hensel
+	}
+
+	var b strings.Builder
+	b.WriteString("B")
+	for n, born := range rule.Birth {
+		if born {
+			fmt.Fprint(&b, n)
+		}
+	}
+	b.WriteString("/S")
+	for n, survives := range rule.Survival {
+		if survives {
+			fmt.Fprint(&b, n)
+		}
+	}
+	if rule.States > 2 {
+		fmt.Fprintf(&b, "/C%d", rule.States)
+	}
+	switch rule.Neighbourhood {
+	case Hexagonal:
+		b.WriteString("H")
+	case VonNeumann:
+		b.WriteString("V")
+	}
+	return b.String()
+}
+
+// grey returns the PGM grey level used to store a cell state.
+// Dead cells are black, alive cells are white and decaying states get darker as they age.
+// Rule tables with more than two states store each state as its own value, so up to 256 states fit in a byte.
+func (rule Rule) grey(state byte) byte {
+	if rule.table != nil && rule.States > 2 {
+		return state
+	}
+	return rule.shade(state)
+}
+
+// shade returns the grey level used to draw a cell state in the GUI.
+// Unlike grey, it spreads the states of rule tables out from white to dark grey so they can be told apart.
+func (rule Rule) shade(state byte) byte {
+	switch state {
+	case dead:
+		return 0
+	case alive:
+		return 255
+	default:
+		return byte(255 - (int(state)-1)*255/(rule.States-1))
+	}
+}
+
+// stateOf returns the cell state stored as the given grey level.
+// ok is false if the grey level is not used by the rule.
+func (rule Rule) stateOf(grey byte) (state byte, ok bool) {
+	for s := 0; s < rule.States; s++ {
+		if rule.grey(byte(s)) == grey {
+			return byte(s), true
+		}
+	}
+	return 0, false
+}
+
+// probabilistic reports whether the rule needs random numbers.
+func (rule Rule) probabilistic() bool {
+	return rule.BirthMiss > 0 || rule.SurvivalMiss > 0
+}
+
+// isAlive reports whether a cell state counts as alive in FinalTurnComplete and AliveCellsCount.
+// Decaying cells of Generations rules are not alive, but every non-zero state of a rule table is.
+func (rule Rule) isAlive(state byte) bool {
+	if rule.table != nil {
+		return state != dead
+	}
+	return state == alive
+}
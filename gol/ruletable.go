@@ -0,0 +1,438 @@
+package gol
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ruleTable is a compiled Golly @TABLE rule.
+// Transitions are matched in file order, and a cell whose neighbourhood matches no transition keeps its state.
+//
+// Rather than trying every transition for each cell, matches[i][s] is a bitset of the transitions
+// that accept state s in position i of the neighbourhood, so the first matching transition is the
+// lowest bit set in all of matches[0][world[y][x]], matches[1][north], ... at once.
+type ruleTable struct {
+	name    string
+	offsets []offset     // Positions of the neighbours after the cell itself, in Golly's order
+	matches [][][]uint64 // matches[i][s] is the bitset of transitions accepting state s at position i
+	outputs []byte       // outputs[t] is the new state given by transition t
+}
+
+// Neighbour orders used by Golly rule tables, clockwise from north.
+var (
+	tableMooreOffsets      = []offset{{0, -1}, {1, -1}, {1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1}}
+	tableVonNeumannOffsets = []offset{{0, -1}, {1, 0}, {0, 1}, {-1, 0}}
+)
+
+// LoadRuleFile reads a Golly .rule file and returns the rule described by its @TABLE section.
+func LoadRuleFile(path string) (Rule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Rule{}, err
+	}
+	defer file.Close()
+
+	rule, err := ParseRuleTable(file)
+	if err != nil {
+		return rule, fmt.Errorf("%v: %v", path, err)
+	}
+	return rule, nil
+}
+
+// ParseRuleTable parses a Golly .rule file with @RULE and @TABLE sections.
+// Variables, inline lists such as {1,2} and all of Golly's symmetries are supported.
+// Other sections such as @COLORS and @ICONS are ignored.
+func ParseRuleTable(r io.Reader) (Rule, error) {
+	parser := tableParser{
+		vars:       make(map[string][]byte),
+		symmetries: "none",
+	}
+	section := ""
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "@") {
+			fields := strings.Fields(line)
+			section = fields[0]
+			if section == "@RULE" && len(fields) > 1 {
+				parser.name = fields[1]
+			}
+			continue
+		}
+		if section != "@TABLE" {
+			continue
+		}
+		if err := parser.parseLine(line); err != nil {
+			return Rule{}, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Rule{}, err
+	}
+	if parser.states == 0 {
+		return Rule{}, fmt.Errorf("no @TABLE section with n_states")
+	}
+
+	table := parser.compile()
+	rule := Rule{
+		States:        parser.states,
+		Range:         1,
+		Neighbourhood: parser.neighbourhood,
+		table:         table,
+	}
+	return rule, nil
+}
+
+// tableParser holds the state of a rule table while it is being read.
+type tableParser struct {
+	name          string
+	states        int
+	neighbourhood Neighbourhood
+	offsets       []offset
+	symmetries    string
+	vars          map[string][]byte
+	transitions   [][][]byte // Each transition is a list of accepted states for every input, then the output
+}
+
+// parseLine handles a single non-empty line of a @TABLE section.
+func (parser *tableParser) parseLine(line string) error {
+	switch {
+	case strings.HasPrefix(line, "n_states:"):
+		states, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "n_states:")))
+		if err != nil || states < 2 || states > 256 {
+			return fmt.Errorf("n_states must be from 2 to 256")
+		}
+		parser.states = states
+	case strings.HasPrefix(line, "neighborhood:"):
+		switch strings.TrimSpace(strings.TrimPrefix(line, "neighborhood:")) {
+		case "Moore":
+			parser.neighbourhood, parser.offsets = Moore, tableMooreOffsets
+		case "vonNeumann":
+			parser.neighbourhood, parser.offsets = VonNeumann, tableVonNeumannOffsets
+		default:
+			return fmt.Errorf("unsupported neighborhood %q, expected Moore or vonNeumann", line)
+		}
+	case strings.HasPrefix(line, "symmetries:"):
+		symmetries := strings.TrimSpace(strings.TrimPrefix(line, "symmetries:"))
+		neighbours := len(tableMooreOffsets)
+		if parser.offsets != nil {
+			neighbours = len(parser.offsets)
+		}
+		if _, ok := symmetryPermutations(symmetries, neighbours); !ok {
+			return fmt.Errorf("unsupported symmetries %q", symmetries)
+		}
+		parser.symmetries = symmetries
+	case strings.HasPrefix(line, "var "):
+		return parser.parseVar(strings.TrimPrefix(line, "var "))
+	default:
+		return parser.parseTransition(line)
+	}
+	return nil
+}
+
+// parseVar handles a variable declaration such as "a={0,1,2}".
+func (parser *tableParser) parseVar(declaration string) error {
+	parts := strings.SplitN(declaration, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid variable declaration %q", declaration)
+	}
+	name := strings.TrimSpace(parts[0])
+	values, err := parser.parseValues(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return err
+	}
+	parser.vars[name] = values
+	return nil
+}
+
+// parseValues parses a state, a variable name or a list such as {0,a,3} into the states it accepts.
+func (parser *tableParser) parseValues(s string) ([]byte, error) {
+	if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+		var values []byte
+		for _, element := range splitList(s[1 : len(s)-1]) {
+			v, err := parser.parseValues(element)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v...)
+		}
+		return values, nil
+	}
+	if values, ok := parser.vars[s]; ok {
+		return values, nil
+	}
+	state, err := strconv.Atoi(s)
+	if err != nil {
+		return nil, fmt.Errorf("unknown variable %q", s)
+	}
+	if parser.states == 0 || state < 0 || state >= parser.states {
+		return nil, fmt.Errorf("state %d is not less than n_states", state)
+	}
+	return []byte{byte(state)}, nil
+}
+
+// splitList splits a comma separated list, leaving commas inside braces alone.
+func splitList(s string) []string {
+	var elements []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				elements = append(elements, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(elements, strings.TrimSpace(s[start:]))
+}
+
+// parseTransition parses a transition, such as "0,1,a,a,0,0,0,0,0,1" or its compact form "01aa000001",
+// and adds every transition it stands for once bound variables and symmetries are expanded.
+func (parser *tableParser) parseTransition(line string) error {
+	if parser.offsets == nil {
+		return fmt.Errorf("transition before neighborhood")
+	}
+	if _, ok := symmetryPermutations(parser.symmetries, len(parser.offsets)); !ok {
+		return fmt.Errorf("symmetries %q cannot be used with this neighborhood", parser.symmetries)
+	}
+	arity := len(parser.offsets) + 2
+
+	var elements []string
+	if strings.Contains(line, ",") {
+		elements = splitList(line)
+	} else {
+		for _, c := range line {
+			elements = append(elements, string(c))
+		}
+	}
+	if len(elements) != arity {
+		return fmt.Errorf("transition %q should have %d entries", line, arity)
+	}
+
+	//A variable used more than once is bound: all its uses take the same value.
+	uses := make(map[string]int)
+	for _, element := range elements {
+		if _, ok := parser.vars[element]; ok {
+			uses[element]++
+		}
+	}
+	var bound []string
+	for name, count := range uses {
+		if count > 1 {
+			bound = append(bound, name)
+		}
+	}
+	sort.Strings(bound)
+	output := elements[arity-1]
+	if _, ok := parser.vars[output]; ok && uses[output] == 1 {
+		return fmt.Errorf("output variable %q is not used in the inputs", output)
+	}
+
+	assignment := make(map[string]byte)
+	var expand func(i int) error
+	expand = func(i int) error {
+		if i < len(bound) {
+			for _, value := range parser.vars[bound[i]] {
+				assignment[bound[i]] = value
+				if err := expand(i + 1); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		transition := make([][]byte, arity)
+		for j, element := range elements {
+			if value, ok := assignment[element]; ok {
+				transition[j] = []byte{value}
+				continue
+			}
+			values, err := parser.parseValues(element)
+			if err != nil {
+				return err
+			}
+			transition[j] = values
+		}
+		if len(transition[arity-1]) != 1 {
+			return fmt.Errorf("output %q must be a single state", output)
+		}
+		parser.addSymmetric(transition)
+		return nil
+	}
+	return expand(0)
+}
+
+// addSymmetric adds a transition along with every distinct rearrangement of its neighbours allowed by the symmetries.
+func (parser *tableParser) addSymmetric(transition [][]byte) {
+	neighbours := transition[1 : len(transition)-1]
+	permutations, _ := symmetryPermutations(parser.symmetries, len(neighbours))
+	if parser.symmetries == "permute" {
+		permutations = distinctPermutations(neighbours)
+	}
+
+	seen := make(map[string]bool)
+	for _, permutation := range permutations {
+		permuted := make([][]byte, len(transition))
+		permuted[0] = transition[0]
+		permuted[len(transition)-1] = transition[len(transition)-1]
+		for i, from := range permutation {
+			permuted[i+1] = neighbours[from]
+		}
+		key := fmt.Sprint(permuted)
+		if !seen[key] {
+			seen[key] = true
+			parser.transitions = append(parser.transitions, permuted)
+		}
+	}
+}
+
+// symmetryPermutations returns, for each symmetric rearrangement, which of the n neighbours (ordered clockwise
+// from north) moves into each position. ok is false if the symmetry is unknown.
+// "permute" is handled by distinctPermutations, so only the identity is returned for it here.
+func symmetryPermutations(symmetries string, n int) (permutations [][]int, ok bool) {
+	rotate := func(by int) []int {
+		permutation := make([]int, n)
+		for i := range permutation {
+			permutation[i] = (i + by) % n
+		}
+		return permutation
+	}
+	reflect := func(permutation []int) []int {
+		reflected := make([]int, n)
+		for i := range reflected {
+			reflected[i] = permutation[(n-i)%n] //Mirror left to right, keeping north in place
+		}
+		return reflected
+	}
+
+	switch symmetries {
+	case "none", "permute":
+		return [][]int{rotate(0)}, true
+	case "reflect_horizontal":
+		return [][]int{rotate(0), reflect(rotate(0))}, true
+	case "rotate4", "rotate4reflect", "rotate8", "rotate8reflect":
+		step := n / 4
+		if strings.HasPrefix(symmetries, "rotate8") {
+			if n != 8 {
+				return nil, false
+			}
+			step = 1
+		}
+		for by := 0; by < n; by += step {
+			permutations = append(permutations, rotate(by))
+			if strings.HasSuffix(symmetries, "reflect") {
+				permutations = append(permutations, reflect(rotate(by)))
+			}
+		}
+		return permutations, true
+	default:
+		return nil, false
+	}
+}
+
+// distinctPermutations returns every rearrangement of the neighbours that gives a different transition,
+// treating inputs that accept the same states as identical so that "permute" stays tractable.
+func distinctPermutations(neighbours [][]byte) [][]int {
+	keys := make([]string, len(neighbours))
+	for i, values := range neighbours {
+		keys[i] = fmt.Sprint(values)
+	}
+
+	var permutations [][]int
+	used := make([]bool, len(neighbours))
+	current := make([]int, 0, len(neighbours))
+	var permute func()
+	permute = func() {
+		if len(current) == len(neighbours) {
+			permutations = append(permutations, append([]int(nil), current...))
+			return
+		}
+		tried := make(map[string]bool)
+		for i := range neighbours {
+			if used[i] || tried[keys[i]] {
+				continue
+			}
+			tried[keys[i]] = true
+			used[i] = true
+			current = append(current, i)
+			permute()
+			current = current[:len(current)-1]
+			used[i] = false
+		}
+	}
+	permute()
+	return permutations
+}
+
+// compile builds the bitsets used to look up transitions.
+func (parser *tableParser) compile() *ruleTable {
+	inputs := len(parser.offsets) + 1
+	words := (len(parser.transitions) + 63) / 64
+	table := &ruleTable{
+		name:    parser.name,
+		offsets: parser.offsets,
+		matches: make([][][]uint64, inputs),
+		outputs: make([]byte, len(parser.transitions)),
+	}
+	for i := range table.matches {
+		table.matches[i] = make([][]uint64, parser.states)
+		for s := range table.matches[i] {
+			table.matches[i][s] = make([]uint64, words)
+		}
+	}
+	for t, transition := range parser.transitions {
+		for i := 0; i < inputs; i++ {
+			for _, s := range transition[i] {
+				table.matches[i][s][t/64] |= 1 << (t % 64)
+			}
+		}
+		table.outputs[t] = transition[inputs][0]
+	}
+	return table
+}
+
+// next returns the state of the cell at (x, y) after one turn.
+func (table *ruleTable) next(p Params, topology Topology, world [][]byte, x, y int) byte {
+	var neighbours [8]byte
+	for i, o := range table.offsets {
+		neighbours[i] = topology.cell(p, world, x+o.dx, y+o.dy)
+	}
+
+	state := world[y][x]
+	candidates := table.matches[0][state]
+	for word := range candidates {
+		match := candidates[word]
+		for i := range table.offsets {
+			if match == 0 {
+				break
+			}
+			match &= table.matches[i+1][neighbours[i]][word]
+		}
+		if match != 0 {
+			return table.outputs[word*64+bits.TrailingZeros64(match)]
+		}
+	}
+	return state
+}
@@ -0,0 +1,115 @@
+package gol
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ScheduleEntry switches the rule to Rule from turn FromTurn onwards.
+// Rule is a rulestring in any of the notations accepted by ParseRule.
+type ScheduleEntry struct {
+	FromTurn int
+	Rule     string
+}
+
+// LoadSchedule reads a rule schedule from a text file with one entry per line,
+// giving the turn to switch on followed by the rulestring, e.g.
+//
+//	# Seeds for 50 turns, then Life forever after
+//	0  B2/S
+//	50 B3/S23
+//
+// Blank lines and anything after a '#' are ignored.
+func LoadSchedule(path string) ([]ScheduleEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var schedule []ScheduleEntry
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%v: line %d: expected a turn and a rulestring", path, lineNumber)
+		}
+		fromTurn, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%v: line %d: %q is not a turn", path, lineNumber, fields[0])
+		}
+		schedule = append(schedule, ScheduleEntry{fromTurn, fields[1]})
+	}
+	return schedule, scanner.Err()
+}
+
+// scheduledRule is a parsed ScheduleEntry.
+type scheduledRule struct {
+	fromTurn int
+	rule     Rule
+}
+
+// newRuleSchedule returns the rules to run in the order they take over. The first starts on turn 0,
+// and is the first entry of p.Schedule if that starts on turn 0, otherwise the rule given by p.
+// Every rule must have the same number of states, so the world and pgm images mean the same throughout.
+func newRuleSchedule(p Params) ([]scheduledRule, error) {
+	first, err := newRule(p)
+	if err != nil {
+		return nil, err
+	}
+	schedule := []scheduledRule{{0, first}}
+
+	for i, entry := range p.Schedule {
+		previous := 0
+		if i > 0 {
+			previous = p.Schedule[i-1].FromTurn
+		}
+		if entry.FromTurn < 0 || (i > 0 && entry.FromTurn <= previous) {
+			return nil, fmt.Errorf("rule schedule turns must be increasing from 0, got %d after %d", entry.FromTurn, previous)
+		}
+		if p.RuleFile != "" {
+			return nil, fmt.Errorf("rule files cannot be used with a rule schedule")
+		}
+
+		entryParams := p
+		entryParams.Rule = entry.Rule
+		rule, err := newRule(entryParams)
+		if err != nil {
+			return nil, fmt.Errorf("rule schedule turn %d: %v", entry.FromTurn, err)
+		}
+		if rule.States != first.States {
+			return nil, fmt.Errorf("rule schedule turn %d: rule %v has %d states, but %v has %d", entry.FromTurn, rule, rule.States, first, first.States)
+		}
+
+		if entry.FromTurn == 0 {
+			schedule[0].rule = rule
+		} else {
+			schedule = append(schedule, scheduledRule{entry.FromTurn, rule})
+		}
+	}
+
+	for i, scheduled := range schedule {
+		if err := checkEngine(p, scheduled.rule); err != nil {
+			return nil, err
+		}
+		if p.Lookup {
+			schedule[i].rule.lookup = newLookupTable(scheduled.rule)
+		}
+	}
+	if err := checkVerify(p); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
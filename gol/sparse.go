@@ -0,0 +1,398 @@
+package gol
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// The sparse engine runs the rule on an unbounded plane instead of the ImageWidth x ImageHeight torus.
+// The plane is stored as a map of 64x64 tiles holding only the tiles with a non-dead cell, so the live
+// area can grow without limit. The image is loaded with its top left corner at the origin, and the
+// image's area stays the window shown by the GUI.
+
+// tileSize is the width and height of the tiles of a sparse world.
+const tileSize = 64
+
+// tileKey is the position of a tile, so the tile holds cells x*tileSize to x*tileSize+tileSize-1.
+type tileKey struct {
+	x, y int
+}
+
+type tile [tileSize][tileSize]byte
+
+// sparseWorld is an unbounded plane of cells, where missing tiles are dead.
+type sparseWorld struct {
+	tiles map[tileKey]*tile
+}
+
+// isSparse reports whether p selects the sparse engine.
+func isSparse(p Params) bool {
+	return strings.EqualFold(strings.TrimSpace(p.Engine), "sparse")
+}
+
+// checkEngine returns an error if the engine, parallel strategy or evaluator selected by p cannot run the rule.
+func checkEngine(p Params, rule Rule) error {
+	if err := checkStrategy(p); err != nil {
+		return err
+	}
+	if err := checkLookup(p, rule); err != nil {
+		return err
+	}
+	switch strings.ToLower(strings.TrimSpace(p.Engine)) {
+	case "", "dense":
+		return nil
+	case "sparse":
+		return checkSparse(p, rule)
+	case "bitpacked":
+		return checkBitPacked(p, rule)
+	case "hashlife":
+		return checkHashLife(p, rule)
+	default:
+		return fmt.Errorf("invalid engine %q: expected dense, sparse, bitpacked or hashlife", p.Engine)
+	}
+}
+
+// checkSparse returns an error if the rule cannot run on an unbounded plane.
+func checkSparse(p Params, rule Rule) error {
+	switch {
+	case p.Topology != "":
+		return fmt.Errorf("the sparse engine runs on an unbounded plane, so it cannot use topology %v", p.Topology)
+	case rule.regions != nil:
+		return fmt.Errorf("the sparse engine runs on an unbounded plane, so it cannot use a mask")
+	case rule.margolus != nil:
+		return fmt.Errorf("the sparse engine cannot run Margolus rules")
+	case rule.probabilistic():
+		return fmt.Errorf("the sparse engine cannot run probabilistic rules")
+	}
+
+	empty := newSparseWorld(nil).next(Params{Threads: 1}, rule, 0)
+	if len(empty.tiles) != 0 {
+		return fmt.Errorf("rule %v fills empty space, so it cannot run on an unbounded plane", rule)
+	}
+	return nil
+}
+
+// newSparseWorld returns a plane holding the world with its top left corner at the origin.
+func newSparseWorld(world [][]byte) *sparseWorld {
+	s := &sparseWorld{tiles: make(map[tileKey]*tile)}
+	for y, row := range world {
+		for x, state := range row {
+			if state != dead {
+				s.set(x, y, state)
+			}
+		}
+	}
+	return s
+}
+
+// floorDiv divides rounding towards minus infinity, so negative cells belong to negative tiles.
+func floorDiv(a, b int) int {
+	if a < 0 {
+		return -((-a + b - 1) / b)
+	}
+	return a / b
+}
+
+func (s *sparseWorld) set(x, y int, state byte) {
+	key := tileKey{floorDiv(x, tileSize), floorDiv(y, tileSize)}
+	t, ok := s.tiles[key]
+	if !ok {
+		t = new(tile)
+		s.tiles[key] = t
+	}
+	t[y-key.y*tileSize][x-key.x*tileSize] = state
+}
+
+// keys returns the positions of the tiles in row-major order, so cells are always reported in the same order.
+func (s *sparseWorld) keys() []tileKey {
+	keys := make([]tileKey, 0, len(s.tiles))
+	for key := range s.tiles {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].y != keys[j].y {
+			return keys[i].y < keys[j].y
+		}
+		return keys[i].x < keys[j].x
+	})
+	return keys
+}
+
+// next returns the plane after one turn, computing the tiles between p.Threads workers.
+// Only tiles with a non-dead cell, and the tiles next to them that their cells are close enough to reach, can change.
+func (s *sparseWorld) next(p Params, rule Rule, turn int) *sparseWorld {
+	halo := tileHalo(rule)
+	candidates := make(map[tileKey]bool)
+	for key, t := range s.tiles {
+		left, top, right, bottom := t.bounds()
+		for dy := -1; dy <= 1; dy++ {
+			if dy < 0 && top >= halo || dy > 0 && bottom < tileSize-halo {
+				continue
+			}
+			for dx := -1; dx <= 1; dx++ {
+				if dx < 0 && left >= halo || dx > 0 && right < tileSize-halo {
+					continue
+				}
+				candidates[tileKey{key.x + dx, key.y + dy}] = true
+			}
+		}
+	}
+	if len(s.tiles) == 0 {
+		candidates[tileKey{0, 0}] = true //An empty plane still has to be checked, for rules that fill empty space
+	}
+
+	type result struct {
+		key  tileKey
+		tile *tile
+	}
+	jobs := make(chan tileKey, len(candidates))
+	results := make(chan result, len(candidates))
+	for key := range candidates {
+		jobs <- key
+	}
+	close(jobs)
+
+	threads := p.Threads
+	if threads < 1 {
+		threads = 1
+	}
+	for i := 0; i < threads; i++ {
+		go func() {
+			for key := range jobs {
+				results <- result{key, s.nextTile(rule, turn, key)}
+			}
+		}()
+	}
+
+	next := &sparseWorld{tiles: make(map[tileKey]*tile)}
+	for range candidates {
+		r := <-results
+		if r.tile != nil {
+			next.tiles[r.key] = r.tile
+		}
+	}
+	return next
+}
+
+// tileHalo returns how many cells around a tile are needed to work out its next turn.
+// The halo is at least the rule's range and even, so rows keep their parity for hexagonal neighbourhoods.
+func tileHalo(rule Rule) int {
+	if rule.Range%2 == 1 {
+		return rule.Range + 1
+	}
+	return rule.Range
+}
+
+// bounds returns the first and last columns and rows of the tile holding a non-dead cell.
+// An empty tile gives bounds that reach no other tile.
+func (t *tile) bounds() (left, top, right, bottom int) {
+	left, top, right, bottom = tileSize, tileSize, -1, -1
+	for y := range t {
+		for x := range t[y] {
+			if t[y][x] == dead {
+				continue
+			}
+			if x < left {
+				left = x
+			}
+			if x > right {
+				right = x
+			}
+			if y < top {
+				top = y
+			}
+			bottom = y
+		}
+	}
+	return left, top, right, bottom
+}
+
+// nextTile returns the tile at key after one turn, or nil if all its cells are dead.
+// It copies the tile and a halo of the cells around it into a small bounded world, so the rule can be run
+// on it like any other world.
+func (s *sparseWorld) nextTile(rule Rule, turn int, key tileKey) *tile {
+	halo := tileHalo(rule)
+	size := tileSize + 2*halo
+	left, top := key.x*tileSize-halo, key.y*tileSize-halo
+
+	local := s.area(left, top, size, size)
+
+	localParams := Params{ImageWidth: size, ImageHeight: size}
+	rule.topology = Topology{edges: bounded}
+	strip := nextStrip(localParams, rule, local, turn, halo, halo+tileSize)
+
+	var t tile
+	empty := true
+	for y := range t {
+		for x := range t[y] {
+			t[y][x] = strip[y][halo+x]
+			if t[y][x] != dead {
+				empty = false
+			}
+		}
+	}
+	if empty {
+		return nil
+	}
+	return &t
+}
+
+// count returns the number of alive cells.
+func (s *sparseWorld) count(rule Rule) int {
+	count := 0
+	for _, t := range s.tiles {
+		for y := range t {
+			for x := range t[y] {
+				if rule.isAlive(t[y][x]) {
+					count++
+				}
+			}
+		}
+	}
+	return count
+}
+
+// alive returns the alive cells with their signed coordinates, in row-major order within each tile.
+func (s *sparseWorld) alive(rule Rule) []util.Cell {
+	var cells []util.Cell
+	for _, key := range s.keys() {
+		t := s.tiles[key]
+		for y := range t {
+			for x := range t[y] {
+				if rule.isAlive(t[y][x]) {
+					cells = append(cells, util.Cell{X: key.x*tileSize + x, Y: key.y*tileSize + y})
+				}
+			}
+		}
+	}
+	return cells
+}
+
+// crop returns the smallest world holding every non-dead cell.
+func (s *sparseWorld) crop() [][]byte {
+	if len(s.tiles) == 0 {
+		return nil
+	}
+	first := true
+	var left, top, right, bottom int
+	for key, t := range s.tiles {
+		for y := range t {
+			for x := range t[y] {
+				if t[y][x] == dead {
+					continue
+				}
+				cx, cy := key.x*tileSize+x, key.y*tileSize+y
+				if first || cx < left {
+					left = cx
+				}
+				if first || cy < top {
+					top = cy
+				}
+				if first || cx > right {
+					right = cx
+				}
+				if first || cy > bottom {
+					bottom = cy
+				}
+				first = false
+			}
+		}
+	}
+
+	return s.area(left, top, right-left+1, bottom-top+1)
+}
+
+// window returns the cells of the plane in the image's area, so the GUI can be sent the cells that changed.
+func (s *sparseWorld) window(p Params) [][]byte {
+	return s.area(0, 0, p.ImageWidth, p.ImageHeight)
+}
+
+// area returns the width x height cells with their top left corner at (left, top).
+// It copies the rows of each tile overlapping the area, rather than looking up every cell.
+func (s *sparseWorld) area(left, top, width, height int) [][]byte {
+	world := make([][]byte, height)
+	for y := range world {
+		world[y] = make([]byte, width)
+	}
+	for ty := floorDiv(top, tileSize); ty <= floorDiv(top+height-1, tileSize); ty++ {
+		for tx := floorDiv(left, tileSize); tx <= floorDiv(left+width-1, tileSize); tx++ {
+			t, ok := s.tiles[tileKey{tx, ty}]
+			if !ok {
+				continue
+			}
+			//Copy the overlap of the tile and the area, in the tile's coordinates
+			startX, endX := clamp(left-tx*tileSize), clamp(left+width-tx*tileSize)
+			startY, endY := clamp(top-ty*tileSize), clamp(top+height-ty*tileSize)
+			for y := startY; y < endY; y++ {
+				copy(world[ty*tileSize+y-top][tx*tileSize+startX-left:], t[y][startX:endX])
+			}
+		}
+	}
+	return world
+}
+
+// clamp limits i to the cells of a tile, 0 to tileSize.
+func clamp(i int) int {
+	if i < 0 {
+		return 0
+	}
+	if i > tileSize {
+		return tileSize
+	}
+	return i
+}
+
+// sparseEngine runs the rule on an unbounded plane, with the image loaded at the origin.
+type sparseEngine struct {
+	p        Params
+	schedule []scheduledRule
+	plane    *sparseWorld
+	turn     int
+	flipped  flipLog
+}
+
+func (e *sparseEngine) Load(world [][]byte, turn int) {
+	e.plane, e.turn = newSparseWorld(world), turn
+	e.flipped = flipLog{}
+}
+
+// Step computes one turn, recording the cells that changed in the image's area.
+func (e *sparseEngine) Step(turns int) int {
+	rule := e.schedule[scheduledAt(e.schedule, e.turn)].rule
+	next := e.plane.next(e.p, rule, e.turn)
+
+	before, after := e.plane.window(e.p), next.window(e.p)
+	var cells []util.Cell
+	var states []byte
+	for y := range before {
+		for x := range before[y] {
+			if before[y][x] != after[y][x] {
+				cells = append(cells, util.Cell{X: x, Y: y})
+				states = append(states, after[y][x])
+			}
+		}
+	}
+	e.flipped.add(cells, states)
+
+	e.plane = next
+	e.turn++
+	return 1
+}
+
+func (e *sparseEngine) Alive() []util.Cell {
+	return e.plane.alive(e.schedule[scheduledAt(e.schedule, e.turn)].rule)
+}
+
+func (e *sparseEngine) Flipped() ([]util.Cell, []byte) {
+	return e.flipped.take()
+}
+
+// Snapshot returns the smallest part of the plane holding every non-dead cell.
+func (e *sparseEngine) Snapshot() [][]byte {
+	return e.plane.crop()
+}
+
+func (e *sparseEngine) Stop() {}
@@ -0,0 +1,93 @@
+package gol
+
+import (
+	"strings"
+	"sync"
+)
+
+// The stealing strategy runs the dense engine on shared-memory workers that each start a turn with their own
+// share of the tiles, in runs of neighbouring tiles so a worker mostly reads cells near the ones it has just read.
+// When activity is bunched in one part of the board, such as a single glider gun in an otherwise empty world,
+// the worker given that part has far more to do than the rest. Workers that run out steal half of what is left
+// of the fullest share, so the busy part is spread between them without any worker waiting on a shared queue.
+
+// isStealing reports whether p selects the work-stealing strategy.
+func isStealing(p Params) bool {
+	return strings.EqualFold(strings.TrimSpace(p.Strategy), "stealing")
+}
+
+// stealQueue holds a deque of tiles for each worker.
+type stealQueue struct {
+	deques []tileDeque
+}
+
+// tileDeque is a worker's share of the tiles. The worker takes from the front and thieves take from the back.
+type tileDeque struct {
+	sync.Mutex
+	tiles []int
+}
+
+// newStealQueue deals the tiles out in order between the deques of the workers.
+// The deques are slices of tiles, which is never written to.
+func newStealQueue(tiles []int, workers int) *stealQueue {
+	q := &stealQueue{deques: make([]tileDeque, workers)}
+	for i := range q.deques {
+		q.deques[i].tiles = tiles[len(tiles)*i/workers : len(tiles)*(i+1)/workers]
+	}
+	return q
+}
+
+// take returns the next tile for worker i from the front of its deque. If its deque is empty, it steals the back
+// half of the fullest deque and takes the first of those tiles, leaving the rest in its own deque for others to
+// steal in turn. Stolen tiles are only out of every deque while the thief holds them, and it then works all of them
+// out itself, so once every deque is empty no tile is left to take.
+func (q *stealQueue) take(i int) (int, bool, bool) {
+	own := &q.deques[i]
+	own.Lock()
+	if len(own.tiles) > 0 {
+		tile := own.tiles[0]
+		own.tiles = own.tiles[1:]
+		own.Unlock()
+		return tile, false, true
+	}
+	own.Unlock()
+
+	for {
+		victim := q.fullest(i)
+		if victim == nil {
+			return 0, false, false
+		}
+		victim.Lock()
+		n := len(victim.tiles)
+		stolen := victim.tiles[n-(n+1)/2:]
+		victim.tiles = victim.tiles[:n-(n+1)/2]
+		victim.Unlock()
+		if len(stolen) == 0 {
+			continue //Its tiles were taken since it was found
+		}
+
+		own.Lock()
+		own.tiles = stolen[1:]
+		own.Unlock()
+		return stolen[0], true, true
+	}
+}
+
+// fullest returns the deque of a worker other than worker i holding the most tiles, or nil if they are all empty.
+func (q *stealQueue) fullest(i int) *tileDeque {
+	var fullest *tileDeque
+	most := 0
+	for j := range q.deques {
+		if j == i {
+			continue
+		}
+		d := &q.deques[j]
+		d.Lock()
+		n := len(d.tiles)
+		d.Unlock()
+		if n > most {
+			fullest, most = d, n
+		}
+	}
+	return fullest
+}
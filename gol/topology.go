@@ -0,0 +1,185 @@
+package gol
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Topology is what happens to neighbourhoods that reach past the edges of the world.
+// The zero Topology is a plain torus.
+type Topology struct {
+	edges  edges
+	twistX bool // Crossing the top or bottom edge reflects the column, as in Klein bottles and cross-surfaces
+	twistY bool // Crossing the left or right edge reflects the row
+	shiftX int  // Crossing the bottom edge moves shiftX columns right, and crossing the top moves them left
+	shiftY int  // Crossing the right edge moves shiftY rows down, and crossing the left moves them up
+	width  int  // Size of the world given by a Golly topology, or 0 if it did not give one
+	height int
+	name   string // Golly topology, used by String
+}
+
+// edges is how the opposite edges of the world are joined.
+type edges int
+
+const (
+	joined  edges = iota // Edges are glued to the opposite edge, possibly with a twist or shift
+	bounded              // Cells outside the world are always dead
+	mirror               // Edges reflect the world, so the cell just outside an edge is a copy of the cell on it
+)
+
+// gollyTopology matches Golly's bounded grid specifications: a plane, torus, Klein bottle or cross-surface
+// letter, the width and height, a '*' after the size of each twisted edge, and an optional shift.
+var gollyTopology = regexp.MustCompile(`^([PTKC])(\d+)(\*?)([+-]\d+)?,(\d+)(\*?)([+-]\d+)?$`)
+
+// ParseTopology parses a topology: "torus", "bounded" or "mirror", or a Golly bounded grid such as
+// "P512,512" for a plane with dead edges, "T512+3,512" for a torus whose top and bottom edges are joined
+// with a shift of 3 cells, "K512*,512" for a Klein bottle whose top and bottom edges are joined with a twist,
+// or "C512,512" for a cross-surface. An empty name gives a torus.
+func ParseTopology(name string) (Topology, error) {
+	var topology Topology
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "torus":
+		return topology, nil
+	case "bounded":
+		topology.edges = bounded
+		return topology, nil
+	case "mirror":
+		topology.edges = mirror
+		return topology, nil
+	}
+
+	match := gollyTopology.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(name)))
+	if match == nil {
+		return topology, fmt.Errorf("invalid topology %q: expected torus, bounded, mirror or a Golly bounded grid such as T512+3,512", name)
+	}
+	topology.name = match[0]
+	topology.width, _ = strconv.Atoi(match[2])
+	topology.height, _ = strconv.Atoi(match[5])
+	topology.twistX, topology.twistY = match[3] == "*", match[6] == "*"
+	topology.shiftX, _ = strconv.Atoi(strings.TrimPrefix(match[4], "+"))
+	topology.shiftY, _ = strconv.Atoi(strings.TrimPrefix(match[7], "+"))
+	if topology.width == 0 || topology.height == 0 {
+		return topology, fmt.Errorf("invalid topology %q: the world cannot be unbounded", name)
+	}
+
+	twisted := topology.twistX || topology.twistY
+	shifted := topology.shiftX != 0 || topology.shiftY != 0
+	switch match[1] {
+	case "P":
+		topology.edges = bounded
+		if twisted || shifted {
+			return topology, fmt.Errorf("invalid topology %q: planes cannot be twisted or shifted", name)
+		}
+	case "T":
+		if twisted || topology.shiftX != 0 && topology.shiftY != 0 {
+			return topology, fmt.Errorf("invalid topology %q: tori cannot be twisted, and can only have a shift on one pair of edges", name)
+		}
+	case "K":
+		if topology.twistX == topology.twistY || shifted {
+			return topology, fmt.Errorf("invalid topology %q: Klein bottles need exactly one pair of twisted edges, such as K512*,512", name)
+		}
+	case "C":
+		if shifted {
+			return topology, fmt.Errorf("invalid topology %q: cross-surfaces cannot be shifted", name)
+		}
+		topology.twistX, topology.twistY = true, true
+	}
+	return topology, nil
+}
+
+// check returns an error if the topology gives a size other than the world's.
+func (topology Topology) check(p Params) error {
+	if topology.width != 0 && (topology.width != p.ImageWidth || topology.height != p.ImageHeight) {
+		return fmt.Errorf("topology %v is %dx%d, but the image is %dx%d", topology, topology.width, topology.height, p.ImageWidth, p.ImageHeight)
+	}
+	return nil
+}
+
+// isTorus reports whether every edge is joined to the opposite edge without a twist or shift.
+func (topology Topology) isTorus() bool {
+	return topology.edges == joined && !topology.twistX && !topology.twistY && topology.shiftX == 0 && topology.shiftY == 0
+}
+
+// wrap returns the cell of the world at (x, y), where (x, y) may be beyond the edges of the world.
+// ok is false if the position is outside a bounded world.
+func (topology Topology) wrap(p Params, x, y int) (wx, wy int, ok bool) {
+	switch topology.edges {
+	case bounded:
+		return x, y, x >= 0 && x < p.ImageWidth && y >= 0 && y < p.ImageHeight
+	case mirror:
+		return reflect(x, p.ImageWidth), reflect(y, p.ImageHeight), true
+	}
+	if topology.isTorus() {
+		return wrapAround(x, p.ImageWidth), wrapAround(y, p.ImageHeight), true
+	}
+
+	// Cross the top and bottom edges first, then the left and right edges. Golly only allows a shift on
+	// one pair of edges, so a row shifted by crossing the left or right edge only has to wrap around.
+	for y < 0 || y >= p.ImageHeight {
+		if y < 0 {
+			y, x = y+p.ImageHeight, x-topology.shiftX
+		} else {
+			y, x = y-p.ImageHeight, x+topology.shiftX
+		}
+		if topology.twistX {
+			x = p.ImageWidth - 1 - x
+		}
+	}
+	for x < 0 || x >= p.ImageWidth {
+		if x < 0 {
+			x, y = x+p.ImageWidth, y-topology.shiftY
+		} else {
+			x, y = x-p.ImageWidth, y+topology.shiftY
+		}
+		if topology.twistY {
+			y = p.ImageHeight - 1 - y
+		}
+	}
+	return x, wrapAround(y, p.ImageHeight), true
+}
+
+// cell returns the state of the cell at (x, y), which is dead if the position is outside a bounded world.
+func (topology Topology) cell(p Params, world [][]byte, x, y int) byte {
+	wx, wy, ok := topology.wrap(p, x, y)
+	if !ok {
+		return dead
+	}
+	return world[wy][wx]
+}
+
+// wrapAround maps i onto 0 to n-1 by wrapping it around the edges, so -1 is n-1 and n is 0.
+func wrapAround(i, n int) int {
+	if i < 0 {
+		i += n
+	} else if i >= n {
+		i -= n
+	}
+	if i < 0 || i >= n {
+		i = (i%n + n) % n //Only neighbourhoods wider than the world reach this far
+	}
+	return i
+}
+
+// reflect maps i onto 0 to n-1 by reflecting it in the edges, so -1 is 0 and n is n-1.
+func reflect(i, n int) int {
+	i = (i%(2*n) + 2*n) % (2 * n)
+	if i >= n {
+		return 2*n - 1 - i
+	}
+	return i
+}
+
+func (topology Topology) String() string {
+	switch {
+	case topology.name != "":
+		return topology.name
+	case topology.edges == bounded:
+		return "bounded"
+	case topology.edges == mirror:
+		return "mirror"
+	default:
+		return "torus"
+	}
+}
@@ -0,0 +1,81 @@
+package gol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// divergenceBoardSize is the largest width and height of a board whose divergence is drawn as text.
+// Larger boards are written to a pgm image of the differing cells instead.
+const divergenceBoardSize = 16
+
+// isVerifying reports whether p asks for the engine to be run in lockstep with a reference engine.
+func isVerifying(p Params) bool {
+	return strings.TrimSpace(p.VerifyAgainst) != ""
+}
+
+// verifyParams returns the parameters of the reference engine p.VerifyAgainst. It runs the same rules on the same
+// world as the engine being verified, but with the dense engine's shared-memory strategy and neighbour counting,
+// so a strategy or the lookup table can be verified against the dense engine too.
+func verifyParams(p Params) Params {
+	p.Engine, p.VerifyAgainst = p.VerifyAgainst, ""
+	p.Strategy, p.Lookup = "", false
+	return p
+}
+
+// engineName returns the name of the engine selected by p.
+func engineName(p Params) string {
+	if name := strings.ToLower(strings.TrimSpace(p.Engine)); name != "" {
+		return name
+	}
+	return "dense"
+}
+
+// checkVerify returns an error if the reference engine cannot run the rules of p, or either engine does not keep
+// its world as the image.
+func checkVerify(p Params) error {
+	if !isVerifying(p) {
+		return nil
+	}
+	reference := verifyParams(p)
+	if isSparse(p) || isSparse(reference) {
+		return fmt.Errorf("the sparse engine runs on an unbounded plane, so it cannot be verified or verified against")
+	}
+	if _, err := newRuleSchedule(reference); err != nil {
+		return fmt.Errorf("verify against %v: %v", p.VerifyAgainst, err)
+	}
+	return nil
+}
+
+// divergence compares the worlds of the engine being verified and the reference after the turn, by their hashes.
+// If they differ, it returns a Divergence event holding the cells whose states differ, drawing them as text for small
+// boards or writing them to a pgm image for larger ones.
+func divergence(p Params, c distributorChannels, rule Rule, engine, reference Engine, turn int) (Divergence, bool) {
+	world, expected := engine.Snapshot(), reference.Snapshot()
+	if hashWorld(world) == hashWorld(expected) {
+		return Divergence{}, false
+	}
+
+	event := Divergence{CompletedTurns: turn, Engine: engineName(p), Against: engineName(verifyParams(p))}
+	diff := make([][]byte, len(world))
+	for y := range world {
+		diff[y] = make([]byte, len(world[y]))
+		for x := range world[y] {
+			if world[y][x] != expected[y][x] {
+				event.Cells = append(event.Cells, util.Cell{X: x, Y: y})
+				diff[y][x] = alive //Drawn white, on black for the cells that agree
+			}
+		}
+	}
+
+	if p.ImageWidth <= divergenceBoardSize && p.ImageHeight <= divergenceBoardSize {
+		event.Board = util.AliveCellsToString(calculateAliveCells(p, rule, world), calculateAliveCells(p, rule, expected), p.ImageWidth, p.ImageHeight)
+	} else {
+		event.Filename = strconv.Itoa(p.ImageWidth) + "x" + strconv.Itoa(p.ImageHeight) + "x" + strconv.Itoa(turn) + "-divergence"
+		writePgm(c, diff, event.Filename, turn)
+	}
+	return event, true
+}
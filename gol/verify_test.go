@@ -0,0 +1,124 @@
+package gol
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestVerifyDivergence verifies the dense engine running B36/S23 against the dense engine running Conway's rule,
+// from two rows of three cells with the cell between their middles the only one with 6 neighbours. The engines must
+// diverge after the first turn at that cell alone. On a 16x16 board the Divergence draws both boards, and on a 32x32
+// board it names an image with the cell in white. The images are written by the io goroutine, as the distributor's are.
+func TestVerifyDivergence(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(dir)
+	if err := os.Mkdir("images", os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, size := range []int{16, 32} {
+		p := Params{ImageWidth: size, ImageHeight: size, Turns: 10, Threads: 2, VerifyAgainst: "dense"}
+		verified := p
+		verified.Rule = "B36/S23"
+		schedule, err := newRuleSchedule(verified)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rule := schedule[0].rule
+		cells := func(cells ...util.Cell) [][]byte {
+			world := make([][]byte, size)
+			for y := range world {
+				world[y] = make([]byte, size)
+			}
+			for _, cell := range cells {
+				world[cell.Y][cell.X] = alive
+			}
+			return world
+		}
+		initial := cells(util.Cell{X: 10, Y: 9}, util.Cell{X: 11, Y: 9}, util.Cell{X: 12, Y: 9},
+			util.Cell{X: 10, Y: 11}, util.Cell{X: 11, Y: 11}, util.Cell{X: 12, Y: 11})
+		name := fmt.Sprintf("%vx%v", size, size)
+		writeTestImage(p, rule, initial, name)
+		if err := os.Rename("out/"+name+".pgm", "images/"+name+".pgm"); err != nil {
+			t.Fatal(err)
+		}
+
+		events := make(chan Event)
+		go run(p, schedule, events, nil)
+		var divergences []Divergence
+		for event := range events {
+			switch e := event.(type) {
+			case Divergence:
+				divergences = append(divergences, e)
+			case TurnComplete:
+				if len(divergences) > 0 {
+					t.Errorf("ERROR: turn %v completed after the engines diverged", e.CompletedTurns)
+				}
+			}
+		}
+
+		expected := Divergence{CompletedTurns: 1, Engine: "dense", Against: "dense", Cells: []util.Cell{{X: 11, Y: 10}}}
+		referenceAlive := []util.Cell{{X: 11, Y: 8}, {X: 11, Y: 9}, {X: 11, Y: 11}, {X: 11, Y: 12}}
+		if size <= divergenceBoardSize {
+			verifiedAlive := append([]util.Cell{{X: 11, Y: 10}}, referenceAlive...)
+			expected.Board = util.AliveCellsToString(verifiedAlive, referenceAlive, size, size)
+		} else {
+			expected.Filename = name + "x1-divergence"
+		}
+		if len(divergences) != 1 || fmt.Sprint(divergences[0]) != fmt.Sprint(expected) {
+			t.Fatalf("ERROR: expected one divergence %#v, got %#v", expected, divergences)
+		}
+
+		s := divergences[0].String()
+		if !strings.HasPrefix(s, "Divergence of dense from dense in 1 cells") {
+			t.Errorf("ERROR: expected the divergence to name the engines and count the cells, got %v", s)
+		}
+		if size <= divergenceBoardSize {
+			if !strings.HasSuffix(s, expected.Board) {
+				t.Errorf("ERROR: expected the %v divergence to draw both boards, got\n%v", name, s)
+			}
+			continue
+		}
+		if !strings.HasSuffix(s, "see out/"+expected.Filename+".pgm") {
+			t.Errorf("ERROR: expected the %v divergence to name its pgm image, got %v", name, s)
+		}
+		writeTestImage(p, rule, cells(util.Cell{X: 11, Y: 10}), "expected-divergence")
+		image, err := os.ReadFile("out/" + expected.Filename + ".pgm")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectedImage, err := os.ReadFile("out/expected-divergence.pgm")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(image) != string(expectedImage) {
+			t.Error("ERROR: the divergence image does not show the one differing cell in white")
+		}
+	}
+}
+
+// writeTestImage writes world to out/<filename>.pgm through the io goroutine, in the grey levels of the rule.
+func writeTestImage(p Params, rule Rule, world [][]byte, filename string) {
+	command, idle := make(chan ioCommand), make(chan bool)
+	filenames, size, output := make(chan string), make(chan int), make(chan uint8)
+	go startIo(p, rule, ioChannels{command: command, idle: idle, filename: filenames, size: size, output: output})
+	writePgm(distributorChannels{
+		events:     make(chan Event, 1),
+		ioCommand:  command,
+		ioIdle:     idle,
+		ioFilename: filenames,
+		ioSize:     size,
+		ioOutput:   output,
+	}, world, filename, 0)
+	close(command)
+}
@@ -3,17 +3,33 @@ package main
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"uk.ac.bris.cs/gameoflife/gol"
 	"uk.ac.bris.cs/gameoflife/util"
 )
 
-// TestGol tests 16x16, 64x64 and 512x512 images on 0, 1 and 100 turns using 1-16 worker threads.
+// TestGol tests 16x16, 64x64 and 512x512 images on 0, 1 and 100 turns using 1-16 worker threads,
+// with the dense, bit-packed and HashLife engines, and the dense engine looking cells up in a table. The 16x16 and
+// 64x64 images are also tested with the dense engine's work-stealing and halo-exchange workers.
 func TestGol(t *testing.T) {
 	tests := []gol.Params{
 		{ImageWidth: 16, ImageHeight: 16},
 		{ImageWidth: 64, ImageHeight: 64},
 		{ImageWidth: 512, ImageHeight: 512},
+		{ImageWidth: 16, ImageHeight: 16, Strategy: "stealing"},
+		{ImageWidth: 64, ImageHeight: 64, Strategy: "stealing"},
+		{ImageWidth: 16, ImageHeight: 16, Strategy: "halo"},
+		{ImageWidth: 64, ImageHeight: 64, Strategy: "halo"},
+		{ImageWidth: 16, ImageHeight: 16, Lookup: true},
+		{ImageWidth: 64, ImageHeight: 64, Lookup: true},
+		{ImageWidth: 512, ImageHeight: 512, Lookup: true},
+		{ImageWidth: 16, ImageHeight: 16, Engine: "bitpacked"},
+		{ImageWidth: 64, ImageHeight: 64, Engine: "bitpacked"},
+		{ImageWidth: 512, ImageHeight: 512, Engine: "bitpacked"},
+		{ImageWidth: 16, ImageHeight: 16, Engine: "hashlife"},
+		{ImageWidth: 64, ImageHeight: 64, Engine: "hashlife"},
+		{ImageWidth: 512, ImageHeight: 512, Engine: "hashlife"},
 	}
 	for _, p := range tests {
 		for _, turns := range []int{0, 1, 100} {
@@ -26,6 +42,15 @@ func TestGol(t *testing.T) {
 			for threads := 1; threads <= 16; threads++ {
 				p.Threads = threads
 				testName := fmt.Sprintf("%dx%dx%d-%d", p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+				if p.Engine != "" {
+					testName = p.Engine + "-" + testName
+				}
+				if p.Lookup {
+					testName = "lookup-" + testName
+				}
+				if p.Strategy != "" {
+					testName = p.Strategy + "-" + testName
+				}
 				t.Run(testName, func(t *testing.T) {
 					events := make(chan gol.Event)
 					go gol.Run(p, events, nil)
@@ -42,3 +67,394 @@ func TestGol(t *testing.T) {
 		}
 	}
 }
+
+// TestGolNoThreads tests that the engines and strategies run the 64x64 image for 100 turns on one worker thread
+// when asked for none or fewer.
+func TestGolNoThreads(t *testing.T) {
+	expectedAlive := readAliveCells("check/images/64x64x100.pgm", 64, 64)
+	for _, p := range []gol.Params{{}, {Strategy: "stealing"}, {Strategy: "halo"}, {Engine: "bitpacked"}, {Engine: "hashlife"}} {
+		for _, threads := range []int{0, -1} {
+			p.ImageWidth, p.ImageHeight, p.Turns, p.Threads = 64, 64, 100, threads
+			name := p.Engine + p.Strategy
+			if name == "" {
+				name = "dense"
+			}
+			testName := fmt.Sprintf("%v-%dx%dx%d-%d", name, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+			t.Run(testName, func(t *testing.T) {
+				events := make(chan gol.Event)
+				go gol.Run(p, events, nil)
+				for event := range events {
+					switch e := event.(type) {
+					case gol.FinalTurnComplete:
+						assertEqualBoard(t, e.Alive, expectedAlive, p)
+					}
+				}
+			})
+		}
+	}
+}
+
+// TestGolTopology tests 16x16 and 64x64 images with bounded and mirror edges on 0, 1 and 100 turns,
+// and 64x64 images on a Klein bottle, cross-surface and shifted torus on 1 and 100 turns, using 1-16 worker threads
+// sharing memory. The 64x64 images are also tested with halo-exchange workers, whose ghost rows must follow the edges,
+// and with cells looked up in a table, which finds the neighbours of cells on the edges through the topology.
+func TestGolTopology(t *testing.T) {
+	tests := []struct {
+		dir      string
+		topology string
+		p        gol.Params
+		turns    []int
+	}{
+		{"bounded", "bounded", gol.Params{ImageWidth: 16, ImageHeight: 16}, []int{0, 1, 100}},
+		{"bounded", "bounded", gol.Params{ImageWidth: 64, ImageHeight: 64}, []int{0, 1, 100}},
+		{"mirror", "mirror", gol.Params{ImageWidth: 16, ImageHeight: 16}, []int{0, 1, 100}},
+		{"mirror", "mirror", gol.Params{ImageWidth: 64, ImageHeight: 64}, []int{0, 1, 100}},
+		{"klein", "K64*,64", gol.Params{ImageWidth: 64, ImageHeight: 64}, []int{1, 100}},
+		{"crosssurface", "C64,64", gol.Params{ImageWidth: 64, ImageHeight: 64}, []int{1, 100}},
+		{"twisted", "T64+3,64", gol.Params{ImageWidth: 64, ImageHeight: 64}, []int{1, 100}},
+		{"bounded", "bounded", gol.Params{ImageWidth: 64, ImageHeight: 64, Strategy: "halo"}, []int{0, 1, 100}},
+		{"mirror", "mirror", gol.Params{ImageWidth: 64, ImageHeight: 64, Strategy: "halo"}, []int{0, 1, 100}},
+		{"klein", "K64*,64", gol.Params{ImageWidth: 64, ImageHeight: 64, Strategy: "halo"}, []int{1, 100}},
+		{"crosssurface", "C64,64", gol.Params{ImageWidth: 64, ImageHeight: 64, Strategy: "halo"}, []int{1, 100}},
+		{"twisted", "T64+3,64", gol.Params{ImageWidth: 64, ImageHeight: 64, Strategy: "halo"}, []int{1, 100}},
+		{"bounded", "bounded", gol.Params{ImageWidth: 64, ImageHeight: 64, Lookup: true}, []int{0, 1, 100}},
+		{"mirror", "mirror", gol.Params{ImageWidth: 64, ImageHeight: 64, Lookup: true}, []int{0, 1, 100}},
+		{"klein", "K64*,64", gol.Params{ImageWidth: 64, ImageHeight: 64, Lookup: true}, []int{1, 100}},
+		{"crosssurface", "C64,64", gol.Params{ImageWidth: 64, ImageHeight: 64, Lookup: true}, []int{1, 100}},
+		{"twisted", "T64+3,64", gol.Params{ImageWidth: 64, ImageHeight: 64, Lookup: true}, []int{1, 100}},
+	}
+	for _, test := range tests {
+		p := test.p
+		p.Topology = test.topology
+		for _, turns := range test.turns {
+			p.Turns = turns
+			expectedAlive := readAliveCells(
+				"check/images/"+test.dir+"/"+fmt.Sprintf("%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, turns),
+				p.ImageWidth,
+				p.ImageHeight,
+			)
+			for threads := 1; threads <= 16; threads++ {
+				p.Threads = threads
+				testName := fmt.Sprintf("%v-%dx%dx%d-%d", test.dir, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+				if p.Lookup {
+					testName = "lookup-" + testName
+				}
+				if p.Strategy != "" {
+					testName = p.Strategy + "-" + testName
+				}
+				t.Run(testName, func(t *testing.T) {
+					events := make(chan gol.Event)
+					go gol.Run(p, events, nil)
+					var cells []util.Cell
+					for event := range events {
+						switch e := event.(type) {
+						case gol.FinalTurnComplete:
+							cells = e.Alive
+						}
+					}
+					assertEqualBoard(t, cells, expectedAlive, p)
+				})
+			}
+		}
+	}
+}
+
+// TestGolTiles tests the 16x16 and 64x64 images on 100 turns with shared-memory workers taking tiles of
+// uneven sizes, strips of rows and tiles larger than the image, using thread counts up to four times the
+// image height, so that some workers find the queue empty. The workers either share one queue or steal
+// from each other's.
+func TestGolTiles(t *testing.T) {
+	tiles := []struct{ width, height int }{{1, 1}, {5, 3}, {64, 1}, {64, 7}, {100, 100}}
+	for _, strategy := range []string{"shared", "stealing"} {
+		for _, size := range []int{16, 64} {
+			p := gol.Params{ImageWidth: size, ImageHeight: size, Turns: 100, Strategy: strategy}
+			expectedAlive := readAliveCells(
+				"check/images/"+fmt.Sprintf("%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, p.Turns),
+				p.ImageWidth,
+				p.ImageHeight,
+			)
+			for _, tile := range tiles {
+				p.TileWidth, p.TileHeight = tile.width, tile.height
+				for _, threads := range []int{1, 3, 7, size - 1, size + 1, 4 * size} {
+					p.Threads = threads
+					testName := fmt.Sprintf("%v-%dx%d-%dx%dx%d-%d", p.Strategy, p.TileWidth, p.TileHeight, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+					t.Run(testName, func(t *testing.T) {
+						events := make(chan gol.Event)
+						go gol.Run(p, events, nil)
+						var cells []util.Cell
+						for event := range events {
+							switch e := event.(type) {
+							case gol.FinalTurnComplete:
+								cells = e.Alive
+							}
+						}
+						assertEqualBoard(t, cells, expectedAlive, p)
+					})
+				}
+			}
+		}
+	}
+}
+
+// TestGolFlipped tests that the dense engine's workers each send the cells they flipped on the first turn of the
+// 512x512 image, for every strategy. The turn must bring more than one CellsFlipped event, all of them before its
+// TurnComplete, and together they must hold each cell that differs between the image and the check image once.
+func TestGolFlipped(t *testing.T) {
+	before := readAliveCells("check/images/512x512x0.pgm", 512, 512)
+	after := readAliveCells("check/images/512x512x1.pgm", 512, 512)
+	expected := make(map[util.Cell]bool)
+	for _, cell := range before {
+		expected[cell] = true
+	}
+	for _, cell := range after {
+		expected[cell] = !expected[cell]
+	}
+	for cell, flipped := range expected {
+		if !flipped {
+			delete(expected, cell)
+		}
+	}
+
+	for _, strategy := range []string{"shared", "stealing", "halo"} {
+		p := gol.Params{ImageWidth: 512, ImageHeight: 512, Turns: 1, Threads: 8, Strategy: strategy}
+		testName := fmt.Sprintf("%v-%dx%dx%d-%d", p.Strategy, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+		t.Run(testName, func(t *testing.T) {
+			events := make(chan gol.Event)
+			go gol.Run(p, events, nil)
+			batches := 0
+			flipped := make(map[util.Cell]bool)
+			completed := false
+			for event := range events {
+				switch e := event.(type) {
+				case gol.CellsFlipped:
+					if completed {
+						t.Errorf("ERROR: CellsFlipped for turn %v arrived after TurnComplete", e.CompletedTurns)
+					}
+					batches++
+					for _, cell := range e.Cells {
+						if flipped[cell] {
+							t.Errorf("ERROR: Cell %v was flipped more than once", cell)
+						}
+						flipped[cell] = true
+					}
+				case gol.TurnComplete:
+					completed = true
+				}
+			}
+			if batches < 2 {
+				t.Errorf("ERROR: Expected a CellsFlipped event from more than one worker, got %v", batches)
+			}
+			if len(flipped) != len(expected) {
+				t.Errorf("ERROR: Expected %v flipped cells, got %v", len(expected), len(flipped))
+			}
+			for cell := range expected {
+				if !flipped[cell] {
+					t.Errorf("ERROR: Cell %v changed on the first turn, but was not flipped", cell)
+					break
+				}
+			}
+		})
+	}
+}
+
+// TestGolWorkerStats tests that the dense engine reports the utilisation of each worker thread before the final
+// turn, whichever strategy the workers use, and that only work-stealing workers steal.
+func TestGolWorkerStats(t *testing.T) {
+	for _, strategy := range []string{"shared", "stealing", "halo"} {
+		p := gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 100, Threads: 4, Strategy: strategy}
+		testName := fmt.Sprintf("%v-%dx%dx%d-%d", p.Strategy, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+		t.Run(testName, func(t *testing.T) {
+			events := make(chan gol.Event)
+			go gol.Run(p, events, nil)
+			var stats *gol.WorkerStats
+			statsBeforeFinal := false
+			for event := range events {
+				switch e := event.(type) {
+				case gol.WorkerStats:
+					stats = &e
+				case gol.FinalTurnComplete:
+					statsBeforeFinal = stats != nil
+				}
+			}
+			if !statsBeforeFinal {
+				t.Fatal("ERROR: No WorkerStats event received before FinalTurnComplete")
+			}
+			if len(stats.Workers) != p.Threads {
+				t.Fatalf("ERROR: Expected stats for %v workers, got %v", p.Threads, len(stats.Workers))
+			}
+			var busy time.Duration
+			for i, worker := range stats.Workers {
+				busy += worker.Busy
+				if worker.Utilisation < 0 || worker.Utilisation > 1 {
+					t.Errorf("ERROR: Worker %v was busy for %v, a utilisation of %v", i, worker.Busy, worker.Utilisation)
+				}
+				if worker.Steals > 0 && strategy != "stealing" {
+					t.Errorf("ERROR: Worker %v stole %v times without the stealing strategy", i, worker.Steals)
+				}
+			}
+			if busy <= 0 {
+				t.Error("ERROR: No worker was busy")
+			}
+		})
+	}
+}
+
+// TestGolSparse tests that the sparse engine runs the 64x64 image for 100 turns on an unbounded plane
+// using 1-16 worker threads, and saves the live cells cropped to their bounding box.
+func TestGolSparse(t *testing.T) {
+	p := gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 100, Engine: "sparse"}
+
+	// After 100 turns the pattern has grown past the top left of the image, into an 81x101 area from (-6, -5).
+	croppedAlive := readAliveCells("check/images/sparse/64x64x100.pgm", 81, 101)
+	var expectedAlive []util.Cell
+	for _, cell := range croppedAlive {
+		expectedAlive = append(expectedAlive, util.Cell{X: cell.X - 6, Y: cell.Y - 5})
+	}
+
+	for threads := 1; threads <= 16; threads++ {
+		p.Threads = threads
+		testName := fmt.Sprintf("%dx%dx%d-%d", p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+		t.Run(testName, func(t *testing.T) {
+			events := make(chan gol.Event)
+			go gol.Run(p, events, nil)
+			var cells []util.Cell
+			for event := range events {
+				switch e := event.(type) {
+				case gol.FinalTurnComplete:
+					cells = e.Alive
+				}
+			}
+			assertEqualBoard(t, cells, expectedAlive, p)
+			assertEqualBoard(t, readAliveCells("out/81x101x100.pgm", 81, 101), croppedAlive, p)
+		})
+	}
+
+	for _, invalid := range []gol.Params{
+		{ImageWidth: 64, ImageHeight: 64, Engine: "sparse", Rule: "B0/S"},
+		{ImageWidth: 64, ImageHeight: 64, Engine: "sparse", Topology: "bounded"},
+		{ImageWidth: 64, ImageHeight: 64, Engine: "sparse", Rule: "BBM"},
+		{ImageWidth: 64, ImageHeight: 64, Engine: "quantum"},
+	} {
+		if _, err := gol.NewRule(invalid); err == nil {
+			t.Errorf("ERROR: engine %v should reject rule %q with topology %q", invalid.Engine, invalid.Rule, invalid.Topology)
+		}
+	}
+}
+
+// TestGolHashLife tests that the HashLife engine gets through 10000 and 10000000000 turns of the 16x16,
+// 64x64 and 512x512 images. By turn 10000 every image has settled into still lifes and oscillators of
+// period 2 or less, so the count at turn 10000 is also the count at any later even turn.
+func TestGolHashLife(t *testing.T) {
+	for _, size := range []int{16, 64, 512} {
+		alive := readAliveCounts(size, size)
+		for _, turns := range []int{10000, 10000000000} {
+			p := gol.Params{ImageWidth: size, ImageHeight: size, Turns: turns, Threads: 1, Engine: "hashlife"}
+			testName := fmt.Sprintf("%dx%dx%d", p.ImageWidth, p.ImageHeight, p.Turns)
+			t.Run(testName, func(t *testing.T) {
+				events := make(chan gol.Event)
+				go gol.Run(p, events, nil)
+				final := gol.FinalTurnComplete{}
+				for event := range events {
+					switch e := event.(type) {
+					case gol.FinalTurnComplete:
+						final = e
+					}
+				}
+				if final.CompletedTurns != turns {
+					t.Fatalf("ERROR: Expected to complete %v turns, completed %v instead", turns, final.CompletedTurns)
+				}
+				if len(final.Alive) != alive[10000] {
+					t.Errorf("ERROR: At turn %v expected %v alive cells, got %v instead", turns, alive[10000], len(final.Alive))
+				}
+			})
+		}
+	}
+}
+
+// TestGolCycle tests that the 512x512 image is found to settle into a cycle of period 2, and that skipping to
+// turns 10000 and 10001 gives the same final board and output image as the HashLife engine working out every turn.
+func TestGolCycle(t *testing.T) {
+	for _, turns := range []int{10000, 10001} {
+		p := gol.Params{ImageWidth: 512, ImageHeight: 512, Turns: turns, Threads: 8, DetectCycles: true}
+		testName := fmt.Sprintf("%dx%dx%d-%d", p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+		t.Run(testName, func(t *testing.T) {
+			emptyOutFolder()
+			hashLife := p
+			hashLife.Engine = "hashlife"
+			events := make(chan gol.Event)
+			go gol.Run(hashLife, events, nil)
+			var expectedAlive []util.Cell
+			for event := range events {
+				switch e := event.(type) {
+				case gol.FinalTurnComplete:
+					expectedAlive = e.Alive
+				}
+			}
+
+			events = make(chan gol.Event)
+			go gol.Run(p, events, nil)
+			var cycle *gol.CycleDetected
+			var cells []util.Cell
+			for event := range events {
+				switch e := event.(type) {
+				case gol.CycleDetected:
+					cycle = &e
+				case gol.FinalTurnComplete:
+					if e.CompletedTurns != turns {
+						t.Errorf("ERROR: Expected to complete %v turns, completed %v instead", turns, e.CompletedTurns)
+					}
+					cells = e.Alive
+				}
+			}
+			if cycle == nil {
+				t.Fatal("ERROR: No CycleDetected event received")
+			}
+			if cycle.Period != 2 || cycle.Turn >= turns {
+				t.Errorf("ERROR: Expected a cycle of period 2 before turn %v, got period %v at turn %v", turns, cycle.Period, cycle.Turn)
+			}
+			assertEqualBoard(t, cells, expectedAlive, p)
+
+			cellsFromImage := readAliveCells(
+				"out/"+fmt.Sprintf("%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, turns),
+				p.ImageWidth,
+				p.ImageHeight,
+			)
+			assertEqualBoard(t, cellsFromImage, expectedAlive, p)
+		})
+	}
+}
+
+// TestGolStochastic tests that a seeded probabilistic rule gives the same 64x64 board after 100 turns using 1-16 worker threads,
+// whether they share memory, steal tiles from each other or exchange halos, as a single shared-memory worker does.
+func TestGolStochastic(t *testing.T) {
+	p := gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 100, SurvivalMiss: 0.01, BirthMiss: 0.05, Seed: 42}
+	run := func(p gol.Params) []util.Cell {
+		events := make(chan gol.Event)
+		go gol.Run(p, events, nil)
+		var cells []util.Cell
+		for event := range events {
+			switch e := event.(type) {
+			case gol.FinalTurnComplete:
+				cells = e.Alive
+			}
+		}
+		return cells
+	}
+
+	reference := p
+	reference.Strategy, reference.Threads = "shared", 1
+	expectedAlive := run(reference)
+	if checkEqualBoard(expectedAlive, readAliveCells("check/images/64x64x100.pgm", p.ImageWidth, p.ImageHeight)) {
+		t.Fatal("ERROR: The probabilistic rule gave the same board as B3/S23")
+	}
+	for _, strategy := range []string{"shared", "stealing", "halo"} {
+		p.Strategy = strategy
+		for threads := 1; threads <= 16; threads++ {
+			p.Threads = threads
+			testName := fmt.Sprintf("%v-%dx%dx%d-%d", p.Strategy, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+			t.Run(testName, func(t *testing.T) {
+				assertEqualBoard(t, run(p), expectedAlive, p)
+			})
+		}
+	}
+}
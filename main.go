@@ -41,6 +41,122 @@ func main() {
 		10000000000,
 		"Specify the number of turns to process. Defaults to 10000000000.")
 
+	flag.StringVar(
+		&params.Rule,
+		"rule",
+		gol.DefaultRule,
+		"Specify the Life-like rule in B/S or S/B notation, e.g. B36/S23, a Generations rule such as B2/S/C3,\n"+
+			"an isotropic non-totalistic rule such as B2-a3/S12,\n"+
+			"a Larger than Life rule such as R5,C0,M1,S34..58,B34..45,NM,\n"+
+			"or a Margolus block rule such as Critters, Tron, BBM or MS,D0;8;4;3;2;5;9;7;1;6;10;11;12;13;14;15. Defaults to B3/S23.")
+
+	flag.StringVar(
+		&params.Neighbourhood,
+		"neighbourhood",
+		"",
+		"Specify the neighbourhood of a Life-like rule: moore, vonneumann or hex. Defaults to the rule's own neighbourhood.")
+
+	flag.StringVar(
+		&params.Topology,
+		"topology",
+		"",
+		"Specify what happens at the edges of the world: torus (wrap around), bounded (dead cells), mirror (reflect),\n"+
+			"or a Golly bounded grid such as T512+3,512 (shifted torus), K512*,512 (Klein bottle) or C512,512 (cross-surface). Defaults to torus.")
+
+	flag.StringVar(
+		&params.RuleFile,
+		"rulefile",
+		"",
+		"Specify a Golly .rule file with a @TABLE section to use instead of -rule, e.g. rules/WireWorld.rule.")
+
+	flag.Float64Var(
+		&params.BirthMiss,
+		"birthmiss",
+		0,
+		"Specify the probability that a birth called for by the rule does not happen. Defaults to 0.")
+
+	flag.Float64Var(
+		&params.SurvivalMiss,
+		"survivalmiss",
+		0,
+		"Specify the probability that a survival called for by the rule does not happen. Defaults to 0.")
+
+	flag.Int64Var(
+		&params.Seed,
+		"seed",
+		0,
+		"Specify the seed for the random numbers used by -birthmiss and -survivalmiss. Defaults to 0.")
+
+	schedule := flag.String(
+		"schedule",
+		"",
+		"Specify a file of '<turn> <rule>' lines giving rules to switch to at later turns, e.g. rules/SeedsToLife.schedule.")
+
+	flag.StringVar(
+		&params.Engine,
+		"engine",
+		"",
+		"Specify the engine: dense for a world the size of the image, bitpacked for a faster one running\n"+
+			"Life-like rules 64 cells at a time, hashlife for one jumping through huge numbers of turns at once,\n"+
+			"or sparse for an unbounded plane with the image at the origin, which saves its output cropped to\n"+
+			"the live cells. Defaults to dense.")
+
+	flag.StringVar(
+		&params.Strategy,
+		"strategy",
+		"",
+		"Specify how the dense engine's workers share the world: shared for one world in shared memory,\n"+
+			"stealing for one world whose tiles are shared out between the workers, which steal from each other\n"+
+			"once they run out, or halo for workers that each own a strip and exchange the rows at its edges\n"+
+			"over channels. Defaults to shared.")
+
+	flag.BoolVar(
+		&params.Lookup,
+		"lookup",
+		false,
+		"Look up the next state of each cell of the dense engine in a table of every 3x3 neighbourhood, generated\n"+
+			"from the rule, instead of counting its neighbours. Only for two state rules of a 3x3 neighbourhood.")
+
+	flag.IntVar(
+		&params.TileWidth,
+		"tilewidth",
+		0,
+		"Specify the width of the tiles shared-memory workers take from their work queue. Defaults to 4,\n"+
+			"or 4 times the range of Larger than Life rules.")
+
+	flag.IntVar(
+		&params.TileHeight,
+		"tileheight",
+		0,
+		"Specify the height of the tiles shared-memory workers take from their work queue. Defaults like -tilewidth.\n"+
+			"Setting -tilewidth to the image width splits the world into strips of rows instead.")
+
+	flag.BoolVar(
+		&params.DetectCycles,
+		"cycles",
+		false,
+		"Watch for the world of the dense or bit-packed engine repeating itself, and once it does, skip whole\n"+
+			"periods of the cycle to the last turn.")
+
+	flag.StringVar(
+		&params.VerifyAgainst,
+		"verify-against",
+		"",
+		"Specify an engine to run in lockstep with -engine from the same image, comparing their worlds after\n"+
+			"every turn and stopping on the first turn they differ. The differing cells are drawn for boards of up\n"+
+			"to 16x16 and written to a pgm image in out/ for larger ones. Not for the sparse engine.")
+
+	flag.StringVar(
+		&params.Mask,
+		"mask",
+		"",
+		"Specify a pgm image the size of the world whose grey levels split it into regions with their own rules, e.g. images/masks/island64x64.pgm.")
+
+	palette := flag.String(
+		"palette",
+		"",
+		"Specify a file of '<grey> <rule> [0xRRGGBB tint]' lines giving the rule of each region of -mask, e.g. rules/Island.palette.")
+
 	headless := flag.Bool(
 		"headless",
 		false,
@@ -48,10 +164,38 @@ func main() {
 
 	flag.Parse()
 
+	if *schedule != "" {
+		entries, err := gol.LoadSchedule(*schedule)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		params.Schedule = entries
+	}
+
+	if *palette != "" {
+		regions, err := gol.LoadPalette(*palette)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		params.Palette = regions
+	}
+
+	rule, err := gol.NewRule(params)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
 	fmt.Printf("%-10v %v\n", "Threads", params.Threads)
 	fmt.Printf("%-10v %v\n", "Width", params.ImageWidth)
 	fmt.Printf("%-10v %v\n", "Height", params.ImageHeight)
 	fmt.Printf("%-10v %v\n", "Turns", params.Turns)
+	fmt.Printf("%-10v %v\n", "Rule", rule)
+	if params.Topology != "" {
+		fmt.Printf("%-10v %v\n", "Topology", params.Topology)
+	}
 
 	keyPresses := make(chan rune, 10)
 	events := make(chan gol.Event, 1000)
@@ -0,0 +1,882 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestRule tests rulestring parsing and that Conway's rule written in other notations matches the check images.
+func TestRule(t *testing.T) {
+	t.Run("parse", testRuleParse)
+	t.Run("conway", func(t *testing.T) { testRuleConway(t, "23/3") })
+	t.Run("largerThanLife", func(t *testing.T) { testRuleConway(t, "R1,C0,M1,S3..4,B3,NM") })
+	t.Run("ranges", testRuleRanges)
+	t.Run("isotropic", func(t *testing.T) { testRuleConway(t, "B3/S2ceaikn3ceaiknjqry") })
+	t.Run("hensel", testRuleHensel)
+	t.Run("neighbourhoods", testRuleNeighbourhoods)
+	t.Run("generations", testRuleGenerations)
+	t.Run("ruleTable", testRuleTable)
+	t.Run("lookup", testRuleLookup)
+	t.Run("margolus", testRuleMargolus)
+	t.Run("schedule", testRuleSchedule)
+	t.Run("regions", testRuleRegions)
+	t.Run("topology", testRuleTopology)
+}
+
+func testRuleParse(t *testing.T) {
+	valid := map[string]string{
+		"":                            "B3/S23",
+		"B3/S23":                      "B3/S23",
+		"b36/s23":                     "B36/S23",
+		"S23/B36":                     "B36/S23",
+		"23/36":                       "B36/S23",
+		"B2/S":                        "B2/S",
+		"/2":                          "B2/S",
+		"B2/S/C3":                     "B2/S/C3",
+		"345/2/4":                     "B2/S345/C4",
+		"B3/S23/2":                    "B3/S23",
+		"R5,C0,M1,S34..58,B34..45,NM": "R5,C0,M1,S34..58,B34..45,NM",
+		"R2,B7..10,S6..13,NC":         "R2,C0,M0,S6..13,B7..10,NC",
+		"B2/S34H":                     "B2/S34H",
+		"B2/S/C3V":                    "B2/S/C3V",
+		"R1,C0,M0,S1..2,B1..3,NN":     "B123/S12V",
+		"B2-a3/S12":                   "B2-a3/S12",
+		"b2ae3aijr/s23-a4itz/c3":      "B2ae3aijr/S23-a4itz/C3",
+		"Critters":                    "Critters",
+		"ms,d15;1;2;3;4;5;6;7;8;9;10;11;12;13;14;0": "MS,D15;1;2;3;4;5;6;7;8;9;10;11;12;13;14;0",
+	}
+	for rulestring, expected := range valid {
+		rule, err := gol.ParseRule(rulestring)
+		if err != nil {
+			t.Errorf("ERROR: %q should be a valid rule, got %v", rulestring, err)
+		} else if rule.String() != expected {
+			t.Errorf("ERROR: %q parsed as %v, expected %v", rulestring, rule, expected)
+		}
+	}
+
+	neighbourhoods := []struct {
+		rule, neighbourhood string
+		height              int
+		valid               bool
+	}{
+		{"B3/S23", "hex", 16, true},
+		{"B2/S34H", "hex", 16, true},
+		{"B3/S23", "vonneumann", 16, true},
+		{"B3/S23", "hex", 15, false},
+		{"B3/S238", "hex", 16, false},
+		{"B2/S34H", "vonneumann", 16, false},
+		{"R2,C0,M0,S2..3,B3..3,NM", "moore", 16, false},
+		{"B3/S23", "triangular", 16, false},
+	}
+	for _, n := range neighbourhoods {
+		p := gol.Params{ImageWidth: 16, ImageHeight: n.height, Rule: n.rule, Neighbourhood: n.neighbourhood}
+		if _, err := gol.NewRule(p); (err == nil) != n.valid {
+			t.Errorf("ERROR: rule %q with neighbourhood %q on height %d should be valid: %v, got error %v", n.rule, n.neighbourhood, n.height, n.valid, err)
+		}
+	}
+
+	for _, rulestring := range []string{"B3", "B9/S23", "B33/S23", "B3/S2/C", "B2/S/C1", "B2/S/C257", "X3/S23", "B3/23", "R11,S1,B1", "R2,S1..30,B1", "R2,S1,B1,NX", "B7/S34H", "B5/S1V", "B1k/S", "B2aa/S", "B2a/S3H", "Ba/S", "MS,D1;2;3", "MS,D0;1;2;3;4;5;6;7;8;9;10;11;12;13;14;16"} {
+		if _, err := gol.ParseRule(rulestring); err == nil {
+			t.Errorf("ERROR: %q should be rejected", rulestring)
+		}
+	}
+}
+
+func testRuleConway(t *testing.T, rule string) {
+	testRuleParams(t, gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 100, Rule: rule})
+}
+
+// testRuleRanges checks Larger than Life rules of each neighbourhood shape, with and without the middle cell, against
+// neighbours counted one by one on a random world. The world is filled up to its edges, so the neighbourhoods of
+// many cells cross an edge of the torus or of the bounded world.
+func testRuleRanges(t *testing.T) {
+	moore := func(dx, dy, r int) bool { return true }
+	vonNeumann := func(dx, dy, r int) bool { return abs(dx)+abs(dy) <= r }
+	circular := func(dx, dy, r int) bool { return dx*dx+dy*dy <= r*r+r }
+	tests := []struct {
+		rule           string
+		r              int
+		middle         bool
+		within         func(dx, dy, r int) bool
+		survive, birth [2]int
+	}{
+		{"R2,C0,M0,S8..12,B9..11,NM", 2, false, moore, [2]int{8, 12}, [2]int{9, 11}},
+		{"R2,C0,M1,S8..12,B9..11,NM", 2, true, moore, [2]int{8, 12}, [2]int{9, 11}},
+		{"R3,C0,M0,S8..12,B9..11,NN", 3, false, vonNeumann, [2]int{8, 12}, [2]int{9, 11}},
+		{"R3,C0,M1,S8..12,B9..11,NN", 3, true, vonNeumann, [2]int{8, 12}, [2]int{9, 11}},
+		{"R3,C0,M0,S12..18,B14..17,NC", 3, false, circular, [2]int{12, 18}, [2]int{14, 17}},
+		{"R3,C0,M1,S12..18,B14..17,NC", 3, true, circular, [2]int{12, 18}, [2]int{14, 17}},
+	}
+
+	random := rand.New(rand.NewSource(1))
+	initial := make([][]byte, 30)
+	for y := range initial {
+		initial[y] = make([]byte, 40)
+		for x := range initial[y] {
+			if random.Float64() < 0.4 {
+				initial[y][x] = 1
+			}
+		}
+	}
+
+	for _, test := range tests {
+		for _, topology := range []string{"", "bounded"} {
+			for _, strategy := range []string{"shared", "halo"} {
+				p := gol.Params{ImageWidth: 40, ImageHeight: 30, Threads: 3, Rule: test.rule, Topology: topology, Strategy: strategy}
+				e := loadEngine(t, p, initial)
+				world := initial
+				for turn := 1; turn <= 5; turn++ {
+					next := make([][]byte, p.ImageHeight)
+					for y := range next {
+						next[y] = make([]byte, p.ImageWidth)
+						for x := range next[y] {
+							count := 0
+							for dy := -test.r; dy <= test.r; dy++ {
+								for dx := -test.r; dx <= test.r; dx++ {
+									if !test.within(dx, dy, test.r) || (dx == 0 && dy == 0 && !test.middle) {
+										continue
+									}
+									nx, ny := x+dx, y+dy
+									if topology == "bounded" && (nx < 0 || nx >= p.ImageWidth || ny < 0 || ny >= p.ImageHeight) {
+										continue
+									}
+									nx, ny = (nx+p.ImageWidth)%p.ImageWidth, (ny+p.ImageHeight)%p.ImageHeight
+									count += int(world[ny][nx])
+								}
+							}
+							bounds := test.birth
+							if world[y][x] == 1 {
+								bounds = test.survive
+							}
+							if count >= bounds[0] && count <= bounds[1] {
+								next[y][x] = 1
+							}
+						}
+					}
+					world = next
+
+					e.Step(1)
+					if !assertWorld(t, e.Snapshot(), world) {
+						t.Fatalf("ERROR: rule %v with topology %q and strategy %v differed from neighbours counted one by one on turn %v", test.rule, topology, strategy, turn)
+					}
+				}
+			}
+		}
+	}
+}
+
+func testRuleParams(t *testing.T, p gol.Params) {
+	dir := "check/images/"
+	if p.Topology != "" {
+		dir += p.Topology + "/"
+	}
+	expectedAlive := readAliveCells(
+		dir+fmt.Sprintf("%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, p.Turns),
+		p.ImageWidth,
+		p.ImageHeight,
+	)
+	for _, strategy := range []string{"shared", "stealing", "halo"} {
+		for _, threads := range []int{1, 4} {
+			p.Strategy, p.Threads = strategy, threads
+			events := make(chan gol.Event)
+			go gol.Run(p, events, nil)
+			var cells []util.Cell
+			for event := range events {
+				switch e := event.(type) {
+				case gol.FinalTurnComplete:
+					cells = e.Alive
+				}
+			}
+			assertEqualBoard(t, cells, expectedAlive, p)
+		}
+	}
+}
+
+// testRuleHensel checks each Hensel letter of 1 to 7 neighbours on a cell surrounded by the letter's configuration as
+// drawn in Golly, which must be born under a rule with that letter alone and not under a rule with every other letter.
+// Configurations of 5 to 7 neighbours are the complements of those of 3 to 1. It then checks generations worked out by
+// hand for pairs of cells under 2a, 2e and 2k, an L of three cells under S2-a, and letters 3j and 4t.
+func testRuleHensel(t *testing.T) {
+	directions := map[string]util.Cell{
+		"N": {X: 0, Y: -1}, "NE": {X: 1, Y: -1}, "E": {X: 1, Y: 0}, "SE": {X: 1, Y: 1},
+		"S": {X: 0, Y: 1}, "SW": {X: -1, Y: 1}, "W": {X: -1, Y: 0}, "NW": {X: -1, Y: -1},
+	}
+	configurations := map[string]string{
+		"1c": "NE", "1e": "N",
+		"2c": "NE SE", "2e": "N E", "2a": "N NE", "2i": "N S", "2k": "N SE", "2n": "NE SW",
+		"3c": "NE SE SW", "3e": "N E S", "3a": "N NE E", "3i": "NW N NE", "3k": "N E SW",
+		"3n": "N NE SE", "3j": "N NE W", "3q": "N NE SW", "3r": "N NE S", "3y": "N SE SW",
+		"4c": "NE SE SW NW", "4e": "N E S W", "4a": "N NE E SE", "4i": "N NE SE S", "4k": "N NE SE W",
+		"4n": "N NE SE NW", "4j": "N NE S W", "4q": "N NE E SW", "4r": "N NE E S", "4y": "N NE SE SW",
+		"4t": "NW N NE S", "4w": "N NE SW W", "4z": "N NE S SW",
+	}
+	letters := []string{"", "ce", "ceaikn", "ceaiknjqry", "ceaiknjqrytwz", "ceaiknjqry", "ceaikn", "ce"}
+
+	p := gol.Params{ImageWidth: 5, ImageHeight: 5}
+	centre := util.Cell{X: 2, Y: 2}
+	for count := 1; count < len(letters); count++ {
+		for _, letter := range letters[count] {
+			name := fmt.Sprintf("%d%c", count, letter)
+			states := make(map[util.Cell]byte)
+			if count <= 4 {
+				for _, direction := range strings.Fields(configurations[name]) {
+					states[util.Cell{X: centre.X + directions[direction].X, Y: centre.Y + directions[direction].Y}] = 1
+				}
+			} else {
+				for _, d := range directions {
+					states[util.Cell{X: centre.X + d.X, Y: centre.Y + d.Y}] = 1
+				}
+				for _, direction := range strings.Fields(configurations[fmt.Sprintf("%d%c", 8-count, letter)]) {
+					delete(states, util.Cell{X: centre.X + directions[direction].X, Y: centre.Y + directions[direction].Y})
+				}
+			}
+
+			for _, lookup := range []bool{false, true} {
+				for _, birth := range []string{name, fmt.Sprintf("%d-%c", count, letter)} {
+					p.Rule, p.Lookup = "B"+birth+"/S", lookup
+					e := loadEngine(t, p, newWorld(p, states))
+					e.Step(1)
+					if born := e.Snapshot()[centre.Y][centre.X] == 1; born != (birth == name) {
+						t.Errorf("ERROR: a cell surrounded by %v was born: %v under %v with lookup %v", name, born, p.Rule, lookup)
+					}
+				}
+			}
+		}
+	}
+
+	p = gol.Params{ImageWidth: 16, ImageHeight: 16}
+	pairs := map[util.Cell]byte{
+		{X: 2, Y: 2}: 1, {X: 3, Y: 2}: 1, //Side by side
+		{X: 8, Y: 2}: 1, {X: 9, Y: 3}: 1, //Diagonal
+		{X: 2, Y: 9}: 1, {X: 4, Y: 10}: 1, //A knight's move apart
+	}
+	tests := []struct {
+		rule     string
+		initial  map[util.Cell]byte
+		expected map[util.Cell]byte
+	}{
+		{"B2a/S", pairs, map[util.Cell]byte{{X: 2, Y: 1}: 1, {X: 3, Y: 1}: 1, {X: 2, Y: 3}: 1, {X: 3, Y: 3}: 1}},
+		{"B2e/S", pairs, map[util.Cell]byte{{X: 9, Y: 2}: 1, {X: 8, Y: 3}: 1}},
+		{"B2k/S", pairs, map[util.Cell]byte{{X: 3, Y: 9}: 1, {X: 3, Y: 10}: 1}},
+		{"B/S2-a", map[util.Cell]byte{{X: 1, Y: 1}: 1, {X: 2, Y: 1}: 1, {X: 1, Y: 2}: 1}, map[util.Cell]byte{{X: 1, Y: 1}: 1}},
+		{"B/S2", map[util.Cell]byte{{X: 1, Y: 1}: 1, {X: 2, Y: 1}: 1, {X: 1, Y: 2}: 1}, map[util.Cell]byte{{X: 1, Y: 1}: 1, {X: 2, Y: 1}: 1, {X: 1, Y: 2}: 1}},
+		{"B3j/S", map[util.Cell]byte{{X: 3, Y: 2}: 1, {X: 4, Y: 2}: 1, {X: 2, Y: 3}: 1}, map[util.Cell]byte{{X: 3, Y: 3}: 1}},
+		{"B3q/S", map[util.Cell]byte{{X: 3, Y: 2}: 1, {X: 4, Y: 2}: 1, {X: 2, Y: 3}: 1}, nil},
+		{"B/S4t", map[util.Cell]byte{{X: 2, Y: 2}: 1, {X: 3, Y: 2}: 1, {X: 4, Y: 2}: 1, {X: 3, Y: 3}: 1, {X: 3, Y: 4}: 1}, map[util.Cell]byte{{X: 3, Y: 3}: 1}},
+		{"B/S4z", map[util.Cell]byte{{X: 2, Y: 2}: 1, {X: 3, Y: 2}: 1, {X: 4, Y: 2}: 1, {X: 3, Y: 3}: 1, {X: 3, Y: 4}: 1}, nil},
+	}
+	for _, test := range tests {
+		p.Rule = test.rule
+		e := loadEngine(t, p, newWorld(p, test.initial))
+		e.Step(1)
+		if !assertWorld(t, e.Snapshot(), newWorld(p, test.expected)) {
+			t.Errorf("ERROR: %v differed from the generation worked out by hand", test.rule)
+		}
+	}
+}
+
+// testRuleNeighbourhoods checks generations of B1/S worked out by hand in the von Neumann and hexagonal
+// neighbourhoods, where a lone cell dies and gives birth to exactly its neighbours. Hexagonal neighbours are
+// checked for cells on even and odd rows, and across the top and bottom edges of the torus.
+func testRuleNeighbourhoods(t *testing.T) {
+	tests := []struct {
+		name, neighbourhood string
+		generations         [][]util.Cell
+	}{
+		{"vonNeumann", "vonneumann", [][]util.Cell{
+			{{X: 2, Y: 2}},
+			{{X: 2, Y: 1}, {X: 1, Y: 2}, {X: 3, Y: 2}, {X: 2, Y: 3}},
+			{{X: 2, Y: 0}, {X: 0, Y: 2}, {X: 4, Y: 2}, {X: 2, Y: 4}},
+		}},
+		{"hexEvenRow", "hex", [][]util.Cell{
+			{{X: 2, Y: 2}},
+			{{X: 1, Y: 1}, {X: 2, Y: 1}, {X: 1, Y: 2}, {X: 3, Y: 2}, {X: 1, Y: 3}, {X: 2, Y: 3}},
+		}},
+		{"hexOddRow", "hex", [][]util.Cell{
+			{{X: 2, Y: 3}},
+			{{X: 2, Y: 2}, {X: 3, Y: 2}, {X: 1, Y: 3}, {X: 3, Y: 3}, {X: 2, Y: 4}, {X: 3, Y: 4}},
+		}},
+		{"hexWrapped", "hex", [][]util.Cell{
+			{{X: 0, Y: 7}},
+			{{X: 0, Y: 6}, {X: 1, Y: 6}, {X: 7, Y: 7}, {X: 1, Y: 7}, {X: 0, Y: 0}, {X: 1, Y: 0}},
+		}},
+	}
+	for _, test := range tests {
+		p := gol.Params{ImageWidth: 8, ImageHeight: 8, Threads: 2, Rule: "B1/S", Neighbourhood: test.neighbourhood}
+		worlds := make([][][]byte, len(test.generations))
+		for i, cells := range test.generations {
+			states := make(map[util.Cell]byte)
+			for _, cell := range cells {
+				states[cell] = 1
+			}
+			worlds[i] = newWorld(p, states)
+		}
+
+		e := loadEngine(t, p, worlds[0])
+		for turn := 1; turn < len(worlds); turn++ {
+			e.Step(1)
+			if !assertWorld(t, e.Snapshot(), worlds[turn]) {
+				t.Errorf("ERROR: %v differed from the generation worked out by hand on turn %v", test.name, turn)
+				break
+			}
+		}
+	}
+}
+
+// testRuleGenerations checks two turns of Brian's Brain worked out by hand, in which alive cells decay through a
+// dying state that does not count as alive. The same world is then run from a pgm image with a grey level for the
+// dying state, which must be shaded in the first CellsShaded event and written back out unchanged, including after the
+// schedule switches to another rule with as many states. Switching to a rule with a different number is rejected.
+func testRuleGenerations(t *testing.T) {
+	p := gol.Params{ImageWidth: 8, ImageHeight: 8, Threads: 4, Rule: "/2/3"}
+	initial := newWorld(p, map[util.Cell]byte{{X: 2, Y: 2}: 1, {X: 3, Y: 2}: 1, {X: 6, Y: 6}: 2})
+	expected := [][][]byte{
+		initial,
+		newWorld(p, map[util.Cell]byte{
+			{X: 2, Y: 1}: 1, {X: 3, Y: 1}: 1, {X: 2, Y: 3}: 1, {X: 3, Y: 3}: 1,
+			{X: 2, Y: 2}: 2, {X: 3, Y: 2}: 2,
+		}),
+		newWorld(p, map[util.Cell]byte{
+			{X: 2, Y: 0}: 1, {X: 3, Y: 0}: 1, {X: 1, Y: 2}: 1, {X: 4, Y: 2}: 1, {X: 2, Y: 4}: 1, {X: 3, Y: 4}: 1,
+			{X: 2, Y: 1}: 2, {X: 3, Y: 1}: 2, {X: 2, Y: 3}: 2, {X: 3, Y: 3}: 2,
+		}),
+	}
+	e := loadEngine(t, p, initial)
+	for turn := 1; turn < len(expected); turn++ {
+		e.Step(1)
+		if !assertWorld(t, e.Snapshot(), expected[turn]) {
+			t.Fatalf("ERROR: Brian's Brain differed from the generation worked out by hand on turn %v", turn)
+		}
+	}
+
+	//Dying cells are drawn half way between alive and dead
+	greys := []byte{0, 255, 128}
+	writeImage(t, p, func(x, y int) byte { return greys[initial[y][x]] })
+	for turns := range expected {
+		p.Turns = turns
+		events := make(chan gol.Event)
+		go gol.Run(p, events, nil)
+		var shaded *gol.CellsShaded
+		var alive []util.Cell
+		for event := range events {
+			switch e := event.(type) {
+			case gol.CellsShaded:
+				if shaded == nil {
+					shaded = &e
+				}
+			case gol.TurnComplete:
+				if shaded == nil {
+					t.Fatal("ERROR: TurnComplete sent before the initial CellsShaded")
+				}
+			case gol.FinalTurnComplete:
+				alive = e.Alive
+			}
+		}
+
+		if shaded == nil || shaded.CompletedTurns != 0 {
+			t.Fatalf("ERROR: expected a CellsShaded event for turn 0, got %v", shaded)
+		}
+		expectedShades := map[util.Cell]byte{{X: 2, Y: 2}: 255, {X: 3, Y: 2}: 255, {X: 6, Y: 6}: 128}
+		shades := make(map[util.Cell]byte)
+		for i, cell := range shaded.Cells {
+			shades[cell] = shaded.Shades[i]
+		}
+		if fmt.Sprint(shades) != fmt.Sprint(expectedShades) {
+			t.Errorf("ERROR: expected the initial cells to be shaded %v, got %v", expectedShades, shades)
+		}
+
+		var expectedAlive []util.Cell
+		for y := range expected[turns] {
+			for x, state := range expected[turns][y] {
+				if state == 1 {
+					expectedAlive = append(expectedAlive, util.Cell{X: x, Y: y})
+				}
+			}
+		}
+		assertEqualBoard(t, alive, expectedAlive, p)
+
+		output, err := os.ReadFile(fmt.Sprintf("out/%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, turns))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(output) != string(pgmImage(p, func(x, y int) byte { return greys[expected[turns][y][x]] })) {
+			t.Errorf("ERROR: the image written after turn %v does not hold the grey level of each state", turns)
+		}
+	}
+
+	//Switching to a rule with no births or survivals leaves only the cells alive on turn 1 dying on turn 2
+	p.Turns, p.Schedule = 2, []gol.ScheduleEntry{{FromTurn: 1, Rule: "B/S/C3"}}
+	events := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+	for range events {
+	}
+	output, err := os.ReadFile(fmt.Sprintf("out/%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, p.Turns))
+	if err != nil {
+		t.Fatal(err)
+	}
+	switched := func(x, y int) byte {
+		if expected[1][y][x] == 1 {
+			return greys[2]
+		}
+		return greys[0]
+	}
+	if string(output) != string(pgmImage(p, switched)) {
+		t.Error("ERROR: the image written after the rule switched does not hold the grey level of each state")
+	}
+
+	//Images hold the grey levels of the first rule, so every rule in a schedule must have as many states
+	for _, rule := range []string{"B3/S23", "/2/4"} {
+		p.Schedule = []gol.ScheduleEntry{{FromTurn: 1, Rule: rule}}
+		if _, err := gol.NewRule(p); err == nil || !strings.Contains(err.Error(), "states") {
+			t.Errorf("ERROR: expected switching from /2/3 to %v to be rejected for its number of states, got %v", rule, err)
+		}
+	}
+}
+
+// testRuleTable checks Conway's rule written as a rule table against the check images, and WireWorld, a four state
+// table, against electrons worked out by hand, and checks that bound variables take one state. An image of WireWorld
+// states must be read and written back unchanged. Tables with bad transitions, variables or symmetries must be rejected.
+func testRuleTable(t *testing.T) {
+	testRuleParams(t, gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 100, RuleFile: "check/rules/LifeTable.rule"})
+
+	//An electron going round a wire that crosses the torus returns to where it started every 8 turns
+	p := gol.Params{ImageWidth: 8, ImageHeight: 8, Threads: 4, RuleFile: "check/rules/WireWorld.rule"}
+	loop := func(turn int) [][]byte {
+		states := make(map[util.Cell]byte)
+		for x := 0; x < p.ImageWidth; x++ {
+			states[util.Cell{X: x, Y: 3}] = 3
+		}
+		states[util.Cell{X: (2 + turn) % p.ImageWidth, Y: 3}] = 1
+		states[util.Cell{X: (1 + turn) % p.ImageWidth, Y: 3}] = 2
+		return newWorld(p, states)
+	}
+	e := loadEngine(t, p, loop(0))
+	for turn := 1; turn <= 2*p.ImageWidth; turn++ {
+		e.Step(1)
+		if !assertWorld(t, e.Snapshot(), loop(turn)) {
+			t.Fatalf("ERROR: the WireWorld electron differed from where it should be on turn %v", turn)
+		}
+	}
+
+	//Wire next to one or two electron heads becomes a head, but not next to three
+	heads := newWorld(p, map[util.Cell]byte{
+		{X: 1, Y: 1}: 1, {X: 2, Y: 1}: 1, {X: 3, Y: 1}: 1, {X: 2, Y: 2}: 3,
+		{X: 5, Y: 1}: 1, {X: 6, Y: 1}: 1, {X: 5, Y: 2}: 3,
+	})
+	e = loadEngine(t, p, heads)
+	e.Step(1)
+	assertWorld(t, e.Snapshot(), newWorld(p, map[util.Cell]byte{
+		{X: 1, Y: 1}: 2, {X: 2, Y: 1}: 2, {X: 3, Y: 1}: 2, {X: 2, Y: 2}: 3,
+		{X: 5, Y: 1}: 2, {X: 6, Y: 1}: 2, {X: 5, Y: 2}: 1,
+	}))
+
+	//A variable used twice takes the same state in both places
+	bound := filepath.Join(t.TempDir(), "Bound.rule")
+	table := "@TABLE\nn_states:3\nneighborhood:Moore\nvar a={1,2}\n0,a,0,0,0,a,0,0,0,1\n"
+	if err := os.WriteFile(bound, []byte(table), 0644); err != nil {
+		t.Fatal(err)
+	}
+	columns := map[util.Cell]byte{{X: 2, Y: 1}: 1, {X: 2, Y: 3}: 1, {X: 5, Y: 1}: 1, {X: 5, Y: 3}: 2}
+	e = loadEngine(t, gol.Params{ImageWidth: 8, ImageHeight: 8, RuleFile: bound}, newWorld(p, columns))
+	e.Step(1)
+	columns[util.Cell{X: 2, Y: 2}] = 1
+	assertWorld(t, e.Snapshot(), newWorld(p, columns))
+
+	//Rule tables with more than two states store each state as its own grey level
+	initial := loop(0)
+	writeImage(t, p, func(x, y int) byte { return initial[y][x] })
+	for _, turns := range []int{0, p.ImageWidth} {
+		p.Turns = turns
+		events := make(chan gol.Event)
+		go gol.Run(p, events, nil)
+		for range events {
+		}
+		output, err := os.ReadFile(fmt.Sprintf("out/%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, turns))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(output) != string(pgmImage(p, func(x, y int) byte { return initial[y][x] })) {
+			t.Errorf("ERROR: the image written after turn %v does not hold the WireWorld states it started with", turns)
+		}
+	}
+
+	invalid := []string{
+		"@TABLE\nn_states:2\nneighborhood:Moore\n0,1,1,1,0,0,0,0,1\n",
+		"@TABLE\nn_states:2\nneighborhood:Moore\n0,1,1,1,0,0,0,0,0,2\n",
+		"@TABLE\nn_states:2\nneighborhood:hexagonal\n",
+		"@TABLE\nn_states:2\n0,1,1,1,0,0,0,0,0,1\n",
+		"@TABLE\nn_states:2\nneighborhood:Moore\nvar a={0,1}\n0,1,1,1,0,0,0,0,0,a\n",
+		"@TABLE\nn_states:2\nneighborhood:Moore\nvar a={0,1}\n0,1,1,1,0,0,0,0,0,{0,1}\n",
+		"@TABLE\nn_states:2\nneighborhood:Moore\nvar a={0,1}\nvar b=c\n",
+		"@TABLE\nn_states:2\nneighborhood:Moore\nvar a={0,2}\n",
+		"@TABLE\nn_states:2\nneighborhood:Moore\n0,1,1,1,0,0,0,0,0,a\n",
+		"@TABLE\nn_states:2\nneighborhood:vonNeumann\nsymmetries:rotate8\n",
+		"@TABLE\nn_states:2\nsymmetries:rotate8\nneighborhood:vonNeumann\n0,1,1,0,0,1\n",
+		"@TABLE\nn_states:2\nneighborhood:Moore\nsymmetries:rotate3\n",
+		"@RULE Empty\n",
+	}
+	for _, table := range invalid {
+		if _, err := gol.ParseRuleTable(strings.NewReader(table)); err == nil {
+			t.Errorf("ERROR: rule table should be rejected:\n%v", table)
+		}
+	}
+}
+
+// testRuleLookup checks that the lookup evaluator gives the check images for Conway's rule written as a rulestring,
+// an isotropic rule and a rule table, and that it rejects rules whose next states are not one 3x3 table.
+func testRuleLookup(t *testing.T) {
+	testRuleParams(t, gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 100, Lookup: true})
+	testRuleParams(t, gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 100, Rule: "B3/S2ceaikn3ceaiknjqry", Lookup: true})
+	testRuleParams(t, gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 100, RuleFile: "check/rules/LifeTable.rule", Lookup: true})
+
+	invalid := []gol.Params{
+		{Rule: "B2/S/C3"},
+		{Rule: "B2/S34H"},
+		{Rule: "R5,C0,M1,S34..58,B34..45,NM"},
+		{Rule: "BBM"},
+		{SurvivalMiss: 0.01},
+		{Engine: "bitpacked"},
+	}
+	for _, p := range invalid {
+		p.ImageWidth, p.ImageHeight, p.Lookup = 16, 16, true
+		if _, err := gol.NewRule(p); err == nil {
+			t.Errorf("ERROR: the lookup evaluator should reject rule %q with engine %q", p.Rule, p.Engine)
+		}
+	}
+}
+
+// testRuleMargolus checks that the billiard ball machine, which never creates or destroys balls,
+// keeps the same number of alive cells and gives the same board using 1-16 worker threads.
+func testRuleMargolus(t *testing.T) {
+	p := gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 100, Rule: "BBM"}
+	initialAlive := readAliveCells("images/64x64.pgm", p.ImageWidth, p.ImageHeight)
+	var expectedAlive []util.Cell
+	for threads := 1; threads <= 16; threads++ {
+		p.Threads = threads
+		events := make(chan gol.Event)
+		go gol.Run(p, events, nil)
+		var cells []util.Cell
+		for event := range events {
+			switch e := event.(type) {
+			case gol.FinalTurnComplete:
+				cells = e.Alive
+			}
+		}
+		if threads == 1 {
+			expectedAlive = cells
+			if len(cells) != len(initialAlive) {
+				t.Errorf("ERROR: BBM started with %v alive cells but finished with %v", len(initialAlive), len(cells))
+			}
+		}
+		assertEqualBoard(t, cells, expectedAlive, p)
+	}
+
+	testRuleBlocks(t)
+
+	if _, err := gol.NewRule(gol.Params{ImageWidth: 15, ImageHeight: 16, Rule: "BBM"}); err == nil {
+		t.Error("ERROR: Margolus rules should need an even image width")
+	}
+}
+
+// testRuleBlocks checks Critters and Tron against a lone cell worked out by hand over turns of both phases, and every
+// block of each against its table as given by MCell, on an even turn and on an odd turn. On odd turns the blocks start
+// one cell further right and down, so the last blocks of each row and column wrap around the torus.
+func testRuleBlocks(t *testing.T) {
+	p := gol.Params{ImageWidth: 8, ImageHeight: 8, Threads: 2}
+	only := func(cells ...util.Cell) [][]byte {
+		states := make(map[util.Cell]byte)
+		for _, cell := range cells {
+			states[cell] = 1
+		}
+		return newWorld(p, states)
+	}
+	allBut := func(cells ...util.Cell) [][]byte {
+		world := only(cells...)
+		for y := range world {
+			for x := range world[y] {
+				world[y][x] = 1 - world[y][x]
+			}
+		}
+		return world
+	}
+
+	tests := []struct {
+		rule   string
+		blocks [16]int
+		lone   [][][]byte // The world after each turn from a lone cell at (0, 0)
+	}{
+		{"Critters", [16]int{15, 14, 13, 3, 11, 5, 6, 1, 7, 9, 10, 2, 12, 4, 8, 0}, [][][]byte{
+			allBut(util.Cell{X: 0, Y: 0}),
+			only(util.Cell{X: 7, Y: 7}),
+			allBut(util.Cell{X: 7, Y: 7}),
+		}},
+		{"Tron", [16]int{15, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 0}, [][][]byte{
+			allBut(util.Cell{X: 1, Y: 0}, util.Cell{X: 0, Y: 1}, util.Cell{X: 1, Y: 1}),
+			only(util.Cell{X: 2, Y: 1}, util.Cell{X: 1, Y: 2}, util.Cell{X: 2, Y: 2},
+				util.Cell{X: 1, Y: 7}, util.Cell{X: 2, Y: 7}, util.Cell{X: 2, Y: 0},
+				util.Cell{X: 7, Y: 1}, util.Cell{X: 7, Y: 2}, util.Cell{X: 0, Y: 2}),
+		}},
+	}
+
+	//blocks returns a world whose block i holds the cells numbered contents(i), with the blocks starting from (offset, offset)
+	blocks := func(offset int, contents func(i int) int) [][]byte {
+		states := make(map[util.Cell]byte)
+		for i := 0; i < 16; i++ {
+			left, top := offset+2*(i%4), offset+2*(i/4)
+			for bit := 0; bit < 4; bit++ {
+				if contents(i)&(1<<bit) != 0 {
+					states[util.Cell{X: (left + bit%2) % p.ImageWidth, Y: (top + bit/2) % p.ImageHeight}] = 1
+				}
+			}
+		}
+		return newWorld(p, states)
+	}
+
+	for _, test := range tests {
+		p.Rule = test.rule
+		e := loadEngine(t, p, only(util.Cell{X: 0, Y: 0}))
+		for turn, expected := range test.lone {
+			e.Step(1)
+			if !assertWorld(t, e.Snapshot(), expected) {
+				t.Errorf("ERROR: %v differed from the lone cell worked out by hand on turn %v", test.rule, turn+1)
+				break
+			}
+		}
+
+		for _, offset := range []int{0, 1} {
+			//Blocks start from (1, 1) on odd turns
+			e.Load(blocks(offset, func(i int) int { return i }), offset)
+			e.Step(1)
+			if !assertWorld(t, e.Snapshot(), blocks(offset, func(i int) int { return test.blocks[i] })) {
+				t.Errorf("ERROR: %v blocks starting from (%v, %v) differed from its table", test.rule, offset, offset)
+			}
+		}
+	}
+}
+
+// testRuleTopology checks that Conway's rule written in each notation honours bounded and mirror edges,
+// and that invalid topologies are rejected.
+func testRuleTopology(t *testing.T) {
+	for _, topology := range []string{"bounded", "mirror"} {
+		p := gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 100, Topology: topology}
+		for _, rule := range []string{"B3/S23", "R1,C0,M1,S3..4,B3,NM", "B3/S2ceaikn3ceaiknjqry"} {
+			p.Rule = rule
+			testRuleParams(t, p)
+		}
+		p.Rule, p.RuleFile = "", "check/rules/LifeTable.rule"
+		testRuleParams(t, p)
+	}
+
+	for _, topology := range []string{"sphere", "T16,32", "K16,16", "K16*,16*", "T16*,16", "T16+1,16+1", "C16+1,16", "P0,0"} {
+		if _, err := gol.NewRule(gol.Params{ImageWidth: 16, ImageHeight: 16, Topology: topology}); err == nil {
+			t.Errorf("ERROR: topology %v should be rejected", topology)
+		}
+	}
+	if _, err := gol.NewRule(gol.Params{ImageWidth: 16, ImageHeight: 16, Rule: "BBM", Topology: "bounded"}); err == nil {
+		t.Error("ERROR: Margolus rules should need a torus")
+	}
+}
+
+// testRuleSchedule checks that schedules switching to Conway's rule match the check images,
+// and that a RuleChanged event is sent on exactly the turn of each switch.
+func testRuleSchedule(t *testing.T) {
+	testRuleParams(t, gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 100, Rule: "B2/S",
+		Schedule: []gol.ScheduleEntry{{FromTurn: 0, Rule: "B3/S23"}}})
+	testRuleParams(t, gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 100,
+		Schedule: []gol.ScheduleEntry{{FromTurn: 30, Rule: "23/3"}, {FromTurn: 60, Rule: "R1,C0,M1,S3..4,B3,NM"}}})
+
+	p := gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 100, Threads: 4,
+		Schedule: []gol.ScheduleEntry{{FromTurn: 50, Rule: "B2/S"}, {FromTurn: 51, Rule: "B3/S23"}}}
+	events := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+	var changes []gol.RuleChanged
+	turn := 0
+	for event := range events {
+		switch e := event.(type) {
+		case gol.TurnComplete:
+			turn = e.CompletedTurns
+		case gol.RuleChanged:
+			if e.CompletedTurns != turn {
+				t.Errorf("ERROR: RuleChanged for turn %v sent after turn %v completed", e.CompletedTurns, turn)
+			}
+			changes = append(changes, e)
+		}
+	}
+	expected := []gol.RuleChanged{{CompletedTurns: 50, Rule: "B2/S"}, {CompletedTurns: 51, Rule: "B3/S23"}}
+	if fmt.Sprint(changes) != fmt.Sprint(expected) {
+		t.Errorf("ERROR: expected rule changes %v, got %v", expected, changes)
+	}
+
+	invalid := [][]gol.ScheduleEntry{
+		{{FromTurn: 50, Rule: "B3/S23"}, {FromTurn: 50, Rule: "B2/S"}},
+		{{FromTurn: 50, Rule: "B3/S23"}, {FromTurn: 10, Rule: "B2/S"}},
+		{{FromTurn: -1, Rule: "B3/S23"}},
+		{{FromTurn: 50, Rule: "B2/S/C3"}},
+		{{FromTurn: 50, Rule: "B9/S"}},
+	}
+	for _, schedule := range invalid {
+		if _, err := gol.NewRule(gol.Params{ImageWidth: 16, ImageHeight: 16, Schedule: schedule}); err == nil {
+			t.Errorf("ERROR: rule schedule should be rejected: %v", schedule)
+		}
+	}
+
+	outOfOrder := []gol.ScheduleEntry{{FromTurn: 20, Rule: "B3/S23"}, {FromTurn: 80, Rule: "B2/S"}, {FromTurn: 40, Rule: "B3/S23"}}
+	if _, err := gol.NewRule(gol.Params{ImageWidth: 16, ImageHeight: 16, Schedule: outOfOrder}); err == nil || !strings.Contains(err.Error(), "got 40 after 80") {
+		t.Errorf("ERROR: expected the rule schedule error to name turns 40 and 80, got %v", err)
+	}
+}
+
+// testRuleRegions checks that a mask covered by one region follows that region's rule,
+// and that a region whose rule never changes a cell keeps its initial cells while the rest of the world evolves.
+func testRuleRegions(t *testing.T) {
+	p := gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 100, Rule: "B2/S"}
+	p.Mask = writeMask(t, p, func(x, y int) byte { return 255 })
+	p.Palette = []gol.Region{{Grey: 255, Rule: "B3/S23"}}
+	testRuleParams(t, p)
+
+	p = gol.Params{ImageWidth: 64, ImageHeight: 64, Turns: 100}
+	p.Mask = writeMask(t, p, func(x, y int) byte { return byte(x / 32 * 255) })
+	p.Palette = []gol.Region{{Grey: 0, Rule: "B/S012345678"}}
+	initialAlive := readAliveCells("images/64x64.pgm", p.ImageWidth, p.ImageHeight)
+	var expectedAlive []util.Cell
+	for _, threads := range []int{1, 4} {
+		p.Threads = threads
+		events := make(chan gol.Event)
+		go gol.Run(p, events, nil)
+		var cells []util.Cell
+		for event := range events {
+			switch e := event.(type) {
+			case gol.FinalTurnComplete:
+				cells = e.Alive
+			}
+		}
+		if threads == 1 {
+			expectedAlive = cells
+			if fmt.Sprint(leftHalf(cells, p)) != fmt.Sprint(leftHalf(initialAlive, p)) {
+				t.Error("ERROR: cells of a region with rule B/S012345678 changed")
+			}
+			if fmt.Sprint(cells) == fmt.Sprint(initialAlive) {
+				t.Error("ERROR: cells outside the region did not follow B3/S23")
+			}
+		}
+		assertEqualBoard(t, cells, expectedAlive, p)
+	}
+
+	invalid := []gol.Params{
+		{ImageWidth: 64, ImageHeight: 64, Palette: p.Palette},
+		{ImageWidth: 64, ImageHeight: 64, Mask: p.Mask},
+		{ImageWidth: 32, ImageHeight: 64, Mask: p.Mask, Palette: p.Palette},
+		{ImageWidth: 64, ImageHeight: 64, Mask: p.Mask, Palette: []gol.Region{{Grey: 0, Rule: "B2/S"}, {Grey: 0, Rule: "B3/S"}}},
+		{ImageWidth: 64, ImageHeight: 64, Mask: p.Mask, Palette: []gol.Region{{Grey: 0, Rule: "B2/S/C3"}}},
+		{ImageWidth: 64, ImageHeight: 64, Mask: p.Mask, Palette: p.Palette, Schedule: []gol.ScheduleEntry{{FromTurn: 10, Rule: "B2/S"}}},
+	}
+	for _, params := range invalid {
+		if _, err := gol.NewRule(params); err == nil {
+			t.Errorf("ERROR: regions should be rejected: mask %q palette %v", params.Mask, params.Palette)
+		}
+	}
+}
+
+// writeMask writes a mask image for p with the given grey level for each cell and returns its path.
+func writeMask(t *testing.T, p gol.Params, grey func(x, y int) byte) string {
+	path := filepath.Join(t.TempDir(), "mask.pgm")
+	if err := os.WriteFile(path, pgmImage(p, grey), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeImage writes the input image of p's size with the given grey level for each cell, and removes it when the
+// test ends. p must be a size with no image of its own.
+func writeImage(t *testing.T, p gol.Params, grey func(x, y int) byte) {
+	path := fmt.Sprintf("images/%vx%v.pgm", p.ImageWidth, p.ImageHeight)
+	if _, err := os.Stat(path); err == nil {
+		t.Fatalf("%v already exists", path)
+	}
+	if err := os.WriteFile(path, pgmImage(p, grey), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(path) })
+}
+
+// pgmImage returns a pgm image of p's size with the given grey level for each cell, as written by the io goroutine.
+func pgmImage(p gol.Params, grey func(x, y int) byte) []byte {
+	pixels := []byte(fmt.Sprintf("P5\n%d %d\n255\n", p.ImageWidth, p.ImageHeight))
+	for y := 0; y < p.ImageHeight; y++ {
+		for x := 0; x < p.ImageWidth; x++ {
+			pixels = append(pixels, grey(x, y))
+		}
+	}
+	return pixels
+}
+
+// leftHalf returns the cells in the left half of the world, sorted so boards can be compared.
+func leftHalf(cells []util.Cell, p gol.Params) []util.Cell {
+	var half []util.Cell
+	for y := 0; y < p.ImageHeight; y++ {
+		for x := 0; x < p.ImageWidth/2; x++ {
+			for _, cell := range cells {
+				if cell.X == x && cell.Y == y {
+					half = append(half, cell)
+				}
+			}
+		}
+	}
+	return half
+}
+
+// loadEngine returns an engine for p that has loaded a copy of the world on turn 0, and is stopped when the test ends.
+func loadEngine(t *testing.T, p gol.Params, world [][]byte) gol.Engine {
+	e, err := gol.NewEngine(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(e.Stop)
+	loaded := make([][]byte, len(world))
+	for y := range world {
+		loaded[y] = append([]byte(nil), world[y]...)
+	}
+	e.Load(loaded, 0)
+	return e
+}
+
+// newWorld returns a world of p's size whose cells are dead except for the given cells, which have the given states.
+func newWorld(p gol.Params, states map[util.Cell]byte) [][]byte {
+	world := make([][]byte, p.ImageHeight)
+	for y := range world {
+		world[y] = make([]byte, p.ImageWidth)
+	}
+	for cell, state := range states {
+		world[cell.Y][cell.X] = state
+	}
+	return world
+}
+
+// assertWorld reports the cells whose states differ between two worlds, and whether there were none.
+func assertWorld(t *testing.T, given, expected [][]byte) bool {
+	t.Helper()
+	same := true
+	for y := range expected {
+		for x := range expected[y] {
+			if given[y][x] != expected[y][x] {
+				t.Errorf("ERROR: cell (%v, %v) has state %v, expected %v", x, y, given[y][x], expected[y][x])
+				same = false
+			}
+		}
+	}
+	return same
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
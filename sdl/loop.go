@@ -11,7 +11,23 @@ import (
 const FPS = 60
 
 func Run(p gol.Params, events <-chan gol.Event, keyPresses chan<- rune) {
-	w := NewWindow(int32(p.ImageWidth), int32(p.ImageHeight))
+	var w *Window
+	if rule, err := gol.NewRule(p); err == nil && rule.Neighbourhood == gol.Hexagonal {
+		w = NewHexWindow(int32(p.ImageWidth), int32(p.ImageHeight)) //Draw odd rows offset so hexagonal patterns look right
+	} else {
+		w = NewWindow(int32(p.ImageWidth), int32(p.ImageHeight))
+	}
+	if p.Mask != "" {
+		if regions, err := gol.LoadMask(p); err == nil {
+			for y, row := range regions {
+				for x, i := range row {
+					if i >= 0 && p.Palette[i].Tint != 0 {
+						w.TintPixel(x, y, p.Palette[i].Tint) //Draw dead cells in the colour of their region
+					}
+				}
+			}
+		}
+	}
 	defer w.Destroy()
 	dirty := false
 	refreshTicker := time.NewTicker(time.Second / time.Duration(FPS))
@@ -57,6 +73,10 @@ sdl:
 				for _, cell := range e.Cells {
 					w.FlipPixel(cell.X, cell.Y) 
 				}
+			case gol.CellsShaded:
+				for i, cell := range e.Cells {
+					w.ShadePixel(cell.X, cell.Y, e.Shades[i])
+				}
 			case gol.TurnComplete:
 				dirty = true
 			case gol.AliveCellsCount:
@@ -65,6 +85,14 @@ sdl:
 				fmt.Printf("Completed Turns %-8v %v\n", event.GetCompletedTurns(), event)
 			case gol.ImageOutputComplete:
 				fmt.Printf("Completed Turns %-8v %v\n", event.GetCompletedTurns(), event)
+			case gol.RuleChanged:
+				fmt.Printf("Completed Turns %-8v %v\n", event.GetCompletedTurns(), event)
+			case gol.CycleDetected:
+				fmt.Printf("Completed Turns %-8v %v\n", event.GetCompletedTurns(), event)
+			case gol.WorkerStats:
+				fmt.Printf("Completed Turns %-8v %v\n", event.GetCompletedTurns(), event)
+			case gol.Divergence:
+				fmt.Printf("Completed Turns %-8v %v\n", event.GetCompletedTurns(), event)
 			case gol.StateChange:
 				fmt.Printf("Completed Turns %-8v %v\n", event.GetCompletedTurns(), event)
 				if e.NewState == gol.Quitting {
@@ -85,6 +113,14 @@ func RunHeadless(events <-chan gol.Event) {
 			fmt.Printf("Completed Turns %-8v %v\n", event.GetCompletedTurns(), "Final Turn Complete")
 		case gol.ImageOutputComplete:
 			fmt.Printf("Completed Turns %-8v %v\n", event.GetCompletedTurns(), event)
+		case gol.RuleChanged:
+			fmt.Printf("Completed Turns %-8v %v\n", event.GetCompletedTurns(), event)
+		case gol.CycleDetected:
+			fmt.Printf("Completed Turns %-8v %v\n", event.GetCompletedTurns(), event)
+		case gol.WorkerStats:
+			fmt.Printf("Completed Turns %-8v %v\n", event.GetCompletedTurns(), event)
+		case gol.Divergence:
+			fmt.Printf("Completed Turns %-8v %v\n", event.GetCompletedTurns(), event)
 		case gol.StateChange:
 			fmt.Printf("Completed Turns %-8v %v\n", event.GetCompletedTurns(), event)
 			if e.NewState == gol.Quitting {
@@ -14,6 +14,8 @@ type Window struct {
 	renderer      *sdl.Renderer
 	texture       *sdl.Texture
 	pixels        []byte
+	hex           bool
+	tints         []byte // Colour of each pixel when its cell is dead, or nil if dead cells are black
 }
 
 func filterEvent(e sdl.Event, userdata interface{}) bool {
@@ -41,9 +43,19 @@ func NewWindow(width, height int32) *Window {
 		renderer,
 		texture,
 		make([]byte, width*height*4),
+		false,
+		nil,
 	}
 }
 
+// NewHexWindow creates a window for a hexagonal world in the offset-row layout.
+// Each cell is drawn 2x2 pixels with odd rows shifted right by one pixel (half a cell), wrapping around the edge.
+func NewHexWindow(width, height int32) *Window {
+	w := NewWindow(2*width, 2*height)
+	w.hex = true
+	return w
+}
+
 func (w *Window) Destroy() {
 	err := w.texture.Destroy()
 	util.Check(err)
@@ -68,37 +80,124 @@ func (w *Window) PollEvent() sdl.Event {
 	return sdl.PollEvent()
 }
 
-func (w *Window) SetPixel(x, y int) {
+// cellPixels returns the indices into pixels of the pixels used to draw the cell at (x, y).
+func (w *Window) cellPixels(x, y int) []int {
 	width := int(w.Width)
-	w.pixels[4*(y*width+x)+0] = 0xFF
-	w.pixels[4*(y*width+x)+1] = 0xFF
-	w.pixels[4*(y*width+x)+2] = 0xFF
-	w.pixels[4*(y*width+x)+3] = 0xFF
+	if !w.hex {
+		return []int{4 * (y*width + x)}
+	}
+	var indices []int
+	for dy := 0; dy < 2; dy++ {
+		for dx := 0; dx < 2; dx++ {
+			px := (2*x + y%2 + dx) % width
+			indices = append(indices, 4*((2*y+dy)*width+px))
+		}
+	}
+	return indices
+}
+
+// cellBounds returns the size of the world drawn in the window.
+func (w *Window) cellBounds() (int, int) {
+	if w.hex {
+		return int(w.Width) / 2, int(w.Height) / 2
+	}
+	return int(w.Width), int(w.Height)
+}
+
+// TintPixel sets the colour the cell is drawn with while it is dead, so regions of the world can be told apart.
+// tint is a 0xRRGGBB colour, which should not be white as alive cells are drawn white.
+func (w *Window) TintPixel(x, y int, tint uint32) {
+	if w.tints == nil {
+		w.tints = make([]byte, len(w.pixels))
+	}
+	for _, i := range w.cellPixels(x, y) {
+		dead := !w.isWhite(i)
+		w.tints[i+0] = byte(tint)       //Blue
+		w.tints[i+1] = byte(tint >> 8)  //Green
+		w.tints[i+2] = byte(tint >> 16) //Red
+		w.tints[i+3] = 0xFF
+		if dead {
+			copy(w.pixels[i:i+4], w.tints[i:i+4])
+		}
+	}
+}
+
+// isWhite reports whether the pixel at index i is drawn white, as alive cells are.
+func (w *Window) isWhite(i int) bool {
+	return w.pixels[i+0] == 0xFF && w.pixels[i+1] == 0xFF && w.pixels[i+2] == 0xFF && w.pixels[i+3] == 0xFF
+}
+
+func (w *Window) SetPixel(x, y int) {
+	for _, i := range w.cellPixels(x, y) {
+		w.pixels[i+0] = 0xFF
+		w.pixels[i+1] = 0xFF
+		w.pixels[i+2] = 0xFF
+		w.pixels[i+3] = 0xFF
+	}
 }
 
 func (w *Window) FlipPixel(x, y int) {
-	if x < 0 || y < 0 || x >= int(w.Width) || y >= int(w.Height) {
+	if width, height := w.cellBounds(); x < 0 || y < 0 || x >= width || y >= height {
 		panic(fmt.Sprintf("CellFlipped event at (%d, %d) is outside the bounds of the window.", x, y))
 	}
 
-	width := int(w.Width)
-	w.pixels[4*(y*width+x)+0] = ^w.pixels[4*(y*width+x)+0]
-	w.pixels[4*(y*width+x)+1] = ^w.pixels[4*(y*width+x)+1]
-	w.pixels[4*(y*width+x)+2] = ^w.pixels[4*(y*width+x)+2]
-	w.pixels[4*(y*width+x)+3] = ^w.pixels[4*(y*width+x)+3]
+	for _, i := range w.cellPixels(x, y) {
+		if w.tints != nil {
+			if w.isWhite(i) {
+				copy(w.pixels[i:i+4], w.tints[i:i+4])
+			} else {
+				copy(w.pixels[i:i+4], []byte{0xFF, 0xFF, 0xFF, 0xFF})
+			}
+			continue
+		}
+		w.pixels[i+0] = ^w.pixels[i+0]
+		w.pixels[i+1] = ^w.pixels[i+1]
+		w.pixels[i+2] = ^w.pixels[i+2]
+		w.pixels[i+3] = ^w.pixels[i+3]
+	}
 }
 
+// ShadePixel sets the pixel to a grey level, so decaying cells can be drawn darker than alive ones.
+func (w *Window) ShadePixel(x, y int, shade uint8) {
+	if width, height := w.cellBounds(); x < 0 || y < 0 || x >= width || y >= height {
+		panic(fmt.Sprintf("CellsShaded event at (%d, %d) is outside the bounds of the window.", x, y))
+	}
+
+	alpha := uint8(0xFF)
+	if shade == 0 {
+		alpha = 0
+	}
+	for _, i := range w.cellPixels(x, y) {
+		if shade == 0 && w.tints != nil {
+			copy(w.pixels[i:i+4], w.tints[i:i+4])
+			continue
+		}
+		w.pixels[i+0] = shade
+		w.pixels[i+1] = shade
+		w.pixels[i+2] = shade
+		w.pixels[i+3] = alpha
+	}
+}
+
+// CountPixels returns the number of white cells in the window.
 func (w *Window) CountPixels() int {
 	count := 0
-	for i := 0; i < int(w.Width) * int(w.Height) * 4; i += 4 {
-		if w.pixels[i] == 0xFF {
-			count++
+	width, height := w.cellBounds()
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if w.isWhite(w.cellPixels(x, y)[0]) {
+				count++
+			}
 		}
 	}
 	return count
 }
 
 func (w *Window) ClearPixels() {
+	if w.tints != nil {
+		copy(w.pixels, w.tints)
+		return
+	}
 	for i := range w.pixels {
 		w.pixels[i] = 0
 	}